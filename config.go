@@ -16,18 +16,55 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
+	"time"
 
 	"github.com/bmatsuo/gutterd/handler"
 	"github.com/bmatsuo/gutterd/watcher"
 )
 
 type Config struct {
-	Path          string           `json:"-"`             // The path of the config file.
-	Statsd        string           `json:"statsd"`        // address of statsd
-	Watch         []watcher.Config `json:"watch"`         // Incoming watch directories.
-	PollFrequency int64            `json:"pollFrequency"` // Poll frequency in seconds.
-	Handlers      []handler.Config `json:"handlers"`      // Ordered set of handlers.
+	Path            string            `json:"-"`               // The path of the config file.
+	Statsd          string            `json:"statsd"`          // address of statsd
+	Watch           []watcher.Config  `json:"watch"`           // Incoming watch directories.
+	Poll            []watcher.Config  `json:"poll"`            // Incoming directories to poll (e.g. NFS mounts).
+	PollFrequency   int64             `json:"pollFrequency"`   // Poll frequency in seconds.
+	QuietPeriod     int64             `json:"quietPeriod"`     // Seconds new files must be unmodified (negative disables).
+	Workers         int               `json:"workers"`         // Number of files handled concurrently.
+	ShutdownTimeout int64             `json:"shutdownTimeout"` // Seconds allowed for queued files at exit.
+	Handlers        []handler.Config  `json:"handlers"`        // Ordered set of handlers.
+	WatchConfig     bool              `json:"watchConfig"`     // Reload when the config file changes.
+	Duplicates      *DuplicatesConfig `json:"duplicates"`      // Detect previously delivered torrents.
+	Unmatched       *UnmatchedConfig  `json:"unmatched"`       // Handle torrents matching no handler.
+	Invalid         *InvalidConfig    `json:"invalid"`         // Quarantine unparseable files.
+}
+
+// Returns the quiet period of created files for the watcher.
+func (config Config) quietPeriod() time.Duration {
+	switch {
+	case config.QuietPeriod == 0:
+		return watcher.DefaultQuietPeriod
+	case config.QuietPeriod < 0:
+		return 0
+	}
+	return time.Duration(config.QuietPeriod) * time.Second
+}
+
+// Returns the number of files handled concurrently.
+func (config Config) workers() int {
+	if config.Workers == 0 {
+		return defaultWorkers
+	}
+	return config.Workers
+}
+
+// Returns the time allowed for handling queued files after a shutdown signal.
+func (config Config) shutdownTimeout() time.Duration {
+	if config.ShutdownTimeout == 0 {
+		return defaultShutdownTimeout
+	}
+	return time.Duration(config.ShutdownTimeout) * time.Second
 }
 
 func (config Config) Validate() error {
@@ -39,18 +76,89 @@ func (config Config) Validate() error {
 			return fmt.Errorf("config: %v", err)
 		}
 	}
+	for _, watcher := range config.Poll {
+		if err := watcher.Validate(); err != nil {
+			return fmt.Errorf("config: poll: %v", err)
+		}
+	}
 	if config.PollFrequency <= 0 {
 		return fmt.Errorf("config: invalid pollFrequency: %d", config.PollFrequency)
 	}
+	if config.Workers < 0 {
+		return fmt.Errorf("config: invalid workers: %d", config.Workers)
+	}
+	if config.ShutdownTimeout < 0 {
+		return fmt.Errorf("config: invalid shutdownTimeout: %d", config.ShutdownTimeout)
+	}
+	names := make(map[string]bool)
 	for _, handler := range config.Handlers {
 		if err := handler.Validate(); err != nil {
 			return fmt.Errorf("config: %v", err)
 		}
+		names[handler.Name] = true
+	}
+	dirs := append(append([]watcher.Config(nil), config.Watch...), config.Poll...)
+	for _, dir := range dirs {
+		for _, name := range dir.Handlers {
+			if !names[name] {
+				return fmt.Errorf("config: watch %s: unknown handler %q", dir, name)
+			}
+		}
+	}
+	for _, handler := range config.Handlers {
+		for _, from := range handler.From {
+			watched := false
+			for _, dir := range dirs {
+				watched = watched || filepath.Clean(dir.Path) == filepath.Clean(from)
+			}
+			if !watched {
+				return fmt.Errorf("config: handler %q: from: not a watch directory: %s", handler.Name, from)
+			}
+		}
+	}
+	if config.Duplicates != nil {
+		if err := config.Duplicates.Validate(); err != nil {
+			return fmt.Errorf("config: %v", err)
+		}
+		if config.Duplicates.Action == "move" {
+			if err := unwatched(dirs, "duplicates", config.Duplicates.Dir); err != nil {
+				return err
+			}
+		}
+	}
+	if config.Unmatched != nil {
+		if err := config.Unmatched.Validate(); err != nil {
+			return fmt.Errorf("config: %v", err)
+		}
+		if config.Unmatched.Action == "move" {
+			if err := unwatched(dirs, "unmatched", config.Unmatched.Dir); err != nil {
+				return err
+			}
+		}
+	}
+	if config.Invalid != nil {
+		if err := config.Invalid.Validate(); err != nil {
+			return fmt.Errorf("config: %v", err)
+		}
+		if err := unwatched(dirs, "invalid", config.Invalid.Dir); err != nil {
+			return err
+		}
 	}
 	// TODO validate Statsd
 	return nil
 }
 
+// Returns an error if the dir of section is watched by one of dirs. Files
+// moved there would be handled again.
+func unwatched(dirs []watcher.Config, section, path string) error {
+	for _, dir := range dirs {
+		if dir.Contains(path) {
+			return fmt.Errorf("config: %s: dir is watched: %s", section, dir)
+		}
+	}
+	return nil
+}
+
 func loadConfigFromBytes(p []byte, path string, defaults *Config) (config *Config, err error) {
 	if config = new(Config); defaults != nil { // Tightly coupled events.
 		*config = *defaults
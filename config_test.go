@@ -7,6 +7,9 @@ package main
  */
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 
@@ -25,7 +28,7 @@ var configValidTests = []struct {
 		`{
 			"http": ":8080",
 			"pollFrequency": 20,
-			"watch": [ "/home/foo/Downloads" ],
+			"watch": [ "/home/foo/Downloads", { "path": "/home/foo/Dropbox", "recursive": true } ],
 			"logs": [ { "path": "&1", "accepts": [ "gutterd" ] } ],
 			"handlers": [ {
 				"name": "foo",
@@ -40,14 +43,16 @@ var configValidTests = []struct {
 		&Config{
 			Path:          "./gutterd.json",
 			PollFrequency: 20,
-			Watch:         []watcher.Config{"/home/foo/Downloads"},
+			Watch: []watcher.Config{
+				watcher.Dir("/home/foo/Downloads"),
+				{Path: "/home/foo/Dropbox", Recursive: true}},
 			Handlers: []handler.Config{{
 				Name:  "foo",
 				Watch: "./",
 				Match: matcher.Config{
-					Tracker:  `tracker\.baz\.net`,
-					Basename: "qux",
-					Ext:      ".quux"}}},
+					Tracker:  matcher.Regex(`tracker\.baz\.net`),
+					Basename: matcher.Regex("qux"),
+					Ext:      matcher.Regex(".quux")}}},
 		}},
 	{ // Test the overloading of default values.
 		`{
@@ -63,19 +68,19 @@ var configValidTests = []struct {
 		"./gutterd.json",
 		&Config{
 			PollFrequency: 30,
-			Watch:         []watcher.Config{"./"},
+			Watch:         []watcher.Config{watcher.Dir("./")},
 		},
 		&Config{
 			Path:          "./gutterd.json",
 			PollFrequency: 30,
-			Watch:         []watcher.Config{"./"},
+			Watch:         []watcher.Config{watcher.Dir("./")},
 			Handlers: []handler.Config{{
 				Name:  "foo",
 				Watch: "./",
 				Match: matcher.Config{
-					Tracker:  `tracker\.baz\.net`,
-					Basename: "qux",
-					Ext:      ".quux"}}},
+					Tracker:  matcher.Regex(`tracker\.baz\.net`),
+					Basename: matcher.Regex("qux"),
+					Ext:      matcher.Regex(".quux")}}},
 		}},
 }
 
@@ -92,3 +97,54 @@ func TestConfig(t *testing.T) {
 		}
 	}
 }
+
+func TestConfigValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gutterd-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	other := filepath.Join(dir, "other") // not watched
+	if err := os.Mkdir(other, 0755); err != nil {
+		t.Fatal(err)
+	}
+	base := Config{
+		Path:          "./gutterd.json",
+		PollFrequency: 60,
+		Watch:         []watcher.Config{watcher.Dir(dir)},
+	}
+	for i, test := range []struct {
+		modify func(c *Config)
+		valid  bool
+	}{
+		{func(c *Config) {}, true},
+		{func(c *Config) { c.Unmatched = &UnmatchedConfig{Action: "rename"} }, true},
+		{func(c *Config) { c.Unmatched = &UnmatchedConfig{Action: "shred"} }, false},
+		{func(c *Config) { c.Unmatched = &UnmatchedConfig{Action: "move"} }, false},
+		{func(c *Config) { c.Unmatched = &UnmatchedConfig{Action: "move", Dir: dir} }, false},
+		{func(c *Config) { c.Unmatched = &UnmatchedConfig{Action: "move", Dir: other} }, true},
+		{func(c *Config) { c.Duplicates = &DuplicatesConfig{} }, true},
+		{func(c *Config) { c.Duplicates = &DuplicatesConfig{Action: "move", Dir: other} }, true},
+		{func(c *Config) { c.Duplicates = &DuplicatesConfig{Action: "move", Dir: dir} }, false},
+		{func(c *Config) { c.Duplicates = &DuplicatesConfig{Action: "move"} }, false},
+		{func(c *Config) { c.Watch[0].Handlers = []string{"foo"} }, false},
+		{func(c *Config) { c.Workers = -1 }, false},
+		{func(c *Config) { c.ShutdownTimeout = -1 }, false},
+		{func(c *Config) { c.Watch[0].Backend = "inotify" }, false},
+		{func(c *Config) { c.Handlers = []handler.Config{{Name: "foo", Watch: dir, From: []string{dir}}} }, true},
+		{func(c *Config) {
+			c.Handlers = []handler.Config{{Name: "foo", Watch: dir, From: []string{filepath.Join(dir, "sub")}}}
+		}, false},
+		{func(c *Config) { c.Invalid = &InvalidConfig{Dir: other} }, true},
+		{func(c *Config) { c.Invalid = &InvalidConfig{Dir: dir} }, false},
+		{func(c *Config) { c.Invalid = &InvalidConfig{} }, false},
+		{func(c *Config) { c.Invalid = &InvalidConfig{Dir: filepath.Join(dir, "missing")} }, false},
+	} {
+		c := base
+		c.Watch = append([]watcher.Config(nil), base.Watch...)
+		test.modify(&c)
+		if err := c.Validate(); (err == nil) != test.valid {
+			t.Errorf("Test %d: unexpected validation result: %v", i, err)
+		}
+	}
+}
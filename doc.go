@@ -14,9 +14,21 @@ your web browser's download directory and Dropbox directories. After analyzing
 their metadata, .torrent files are moved to different BitTorrent clients'
 watched directories.
 
+Magnet links saved as .magnet files (text files containing a magnet:? URI) are
+handled like .torrent files. Their display name, trackers, length and
+info-hash are matched against handlers.
+
+At startup, .torrent and .magnet files already present in watched directories (e.g. those
+downloaded while gutterd was not running) are handled alongside new files.
+
 Usage:
 
     gutterd [options]
+    gutterd test [options] file...
+
+The test command (or the -dry-run option) explains which handler each file
+would be delivered to, printing the result of every handler pattern, without
+delivering anything.
 
 Options:
 
@@ -26,6 +38,9 @@ configuration file. Default values will be ignored.
 	-config=""
   			A config file to use instead of ~/.config/gutterd.json.
 
+	-dry-run=false
+			Explain which handler each file argument matches and exit.
+
 	-poll=0
 			Specify a polling frequency (in seconds).
 
@@ -41,11 +56,172 @@ to match against and demux those files. Here is an example configuration.
 An example configuration can be found at
 https://github.com/bmatsuo/gutterd/tree/master/example.config.json
 
+Watch directories:
+
+Watch and poll directories are either paths or objects. An object with
+"recursive": true also watches subdirectories, including those created while
+gutterd is running. "depth" limits how many levels of subdirectories are
+watched, and subdirectories whose name or relative path matches an "exclude"
+glob are skipped.
+
+Only files whose name matches the "pattern" glob, and matches no "ignore"
+glob, are handled. "backend": "poll" polls the directory every "pollInterval"
+seconds (by default "pollFrequency") instead of using fsnotify. A "handlers"
+list restricts the torrents found in the directory to the named handlers.
+Unknown keys are rejected.
+
+Without a "pattern" only .torrent and .magnet files are handled. In a
+directory with a "pattern" every matching file is handled, so text files
+containing magnet links can be picked up with e.g. "pattern": "*.txt".
+
+	"watch": [
+		"/Users/b/Downloads",
+		{ "path": "/Users/b/Dropbox/torrents", "recursive": true, "depth": 2, "exclude": [ ".*" ] },
+		{ "path": "/Volumes/nas/torrents", "backend": "poll", "pollInterval": 300,
+		  "ignore": [ "*.part" ], "handlers": [ "tv" ] }
+	]
+
+Polling:
+
+Directories listed under "poll" in the configuration are scanned every
+"pollFrequency" seconds instead of being watched with fsnotify. This is
+useful for network filesystems (NFS, SMB) where change notifications are never
+delivered. Watch directories that fsnotify fails to register are polled
+automatically.
+
+New files are handled once they have gone "quietPeriod" seconds (default 2)
+without being modified or changing size, so that files still being written
+by a browser are not read early. A negative "quietPeriod" handles files as
+soon as they are created.
+
+Up to "workers" files (default 4) are handled at once. A file that is already
+waiting or being handled is not queued again, and files with the same
+info-hash are handled one at a time.
+
+Reloading:
+
+Sending gutterd SIGHUP reloads the configuration file. Handlers are replaced
+and watch directories are updated. If the new configuration is invalid the
+current one is kept and the error is logged. When "watchConfig" is true the
+configuration is also reloaded whenever the file changes. Changes to
+"workers" and "statsd" take effect only after a restart.
+
+Shutdown:
+
+On SIGINT or SIGTERM gutterd stops watching and finishes the files already
+queued. If they are not handled within "shutdownTimeout" seconds (default 30)
+the remaining files are left in place, running exec commands are killed, and
+gutterd exits with status 1. A second signal exits immediately. Stats are flushed before exiting.
+
 Handlers:
 
 When handler "match" properties are unspecified, they will match any torrent.
 Torrents are matched against handlers in order. So, in the example above, the
 'other' handler acts as a catch-all and will match all torrents not matched by
 any other handler.
+
+Patterns (such as "tracker", "basename", "ext", "path", "comment" and
+"createdBy") are regular expressions when given as strings. They may instead
+be objects with one of the keys "regex", "glob" or "literal", and optionally
+"ignoreCase", or lists of patterns of which any may match.
+
+	"ext": { "glob": ".iso", "ignoreCase": true }
+	"tracker": [ { "literal": "ubuntu.com" }, { "literal": "debian.org" } ]
+
+Regular expressions and literals match anywhere in a value. Globs must match
+the whole value; "*" and "?" do not match '/', while "**" does. Tracker urls
+contain slashes, so a tracker glob needs "**" on both sides of the host.
+
+	"tracker": { "glob": "**tracker.org**" }
+
+The "tracker" pattern matches if it matches any url in a torrent's
+announce-list (BEP-12). Set "primaryTracker" to true to match only the
+announce url.
+
+In multi-file torrents the "ext" pattern matches if any file's extension
+matches. Set "extMode" to "all" to require every file to match, "largest" to
+test only the largest file, or "majority" to require matching files to make up
+more than half of the torrent's bytes.
+
+The "path" pattern matches the slash-separated path of each file relative to
+the torrent's root directory, e.g. "BDMV/index.bdmv". Set "pathMode" to "all"
+to require every file's path to match.
+
+Numeric constraints restrict the total size ("minSize", "maxSize"), the
+size of the largest file ("minFileSize", "maxFileSize"), the number of files
+("minFiles", "maxFiles") and the piece length ("minPieceLength",
+"maxPieceLength"). Sizes are numbers of bytes or strings with units such as
+"700MB" or "4GiB".
+
+The "private" property (true or false) matches the torrent's private flag.
+The "comment" and "createdBy" patterns match the corresponding metadata. The
+creation date may be restricted with "createdAfter" and "createdBefore"
+(RFC 3339 timestamps or dates like "2014-01-31") and with "maxAge" (a
+duration like "36h" or "30d"). Torrents without a creation date fail date
+constraints.
+
+Matchers can be combined. A match may contain an "all" list of matchers
+that must all match, an "any" list of which at least one must match, and a
+"not" matcher that must not match, in addition to its own properties. For
+example, to match either of two trackers but not samples:
+
+	"match": {
+		"any": [ { "tracker": "tracker[.]a[.]org" }, { "tracker": "tracker[.]b[.]org" } ],
+		"not": { "basename": "(?i)sample" }
+	}
+
+A handler with a "from" list only handles torrents found in the listed watch
+directories, so the same tracker can be handled differently for different
+download folders. A torrent in nested watch directories is found in the
+innermost one.
+
+	{ "name": "work", "watch": "/Users/b/Work/watch", "from": [ "/Users/b/Dropbox/work-torrents" ],
+	  "match": { "tracker": "tracker[.]a[.]org" } }
+
+Unmatched torrents:
+
+By default torrents matching no handler are left where they are. An
+"unmatched" section selects a different "action": "move" moves them into
+"dir" (which must not be watched), "delete" removes them, and "rename" adds
+a .unmatched suffix so they are not handled again at startup.
+Files moved into a directory never replace a file of the same name; a number
+is added to the name instead (e.g. download (1).torrent). This applies to the
+"duplicates" and "invalid" directories as well.
+
+Invalid files:
+
+Files that cannot be parsed are often still being written. When the
+configuration has an "invalid" section they are read again after
+"retryDelay" seconds (default 5, negative to disable), and files that still
+cannot be parsed are moved into "dir" (which must not be watched) along with a
+.error.txt file describing the error.
+
+	"invalid": { "dir": "/Users/b/Invalid", "retryDelay": 10 }
+
+Duplicates:
+
+When the configuration has a "duplicates" section, the info-hash of every
+delivered torrent is recorded in a store file ("store", by default
+~/.local/share/gutterd/torrents.json). Torrents that were delivered before are
+handled according to the "action": "skip" (the default) deletes the file,
+"move" moves it into "dir" (which must not be watched), and "deliver"
+delivers it again. A file left in place by the action that delivered it is not
+removed or moved when it is seen again.
+
+	"duplicates": { "action": "move", "dir": "/Users/b/Duplicates" }
+
+Actions:
+
+A handler's "action" determines how matching .torrent files are delivered. The
+action "type" may be "move" (the default), "copy", "symlink", "hardlink", or
+"exec". Exec actions run a "command", each argument of which is a template
+with access to the fields {{.Path}}, {{.Name}}, {{.Handler}}, {{.Watch}},
+{{.Dest}}, and {{.Torrent}}.
+
+	"action": { "type": "exec", "command": [ "transmission-remote", "-a", "{{.Path}}" ] }
+
+Actions other than "move" leave the .torrent file in the download directory.
+The file is renamed with a .handled suffix before delivery so that it is not
+delivered again at startup.
 */
 package documentation
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	"github.com/bmatsuo/gutterd/handler"
+	"github.com/bmatsuo/gutterd/metadata"
+	"github.com/bmatsuo/gutterd/statsd"
+	"github.com/bmatsuo/gutterd/store"
+)
+
+// Returned by handleFile for duplicate torrents that were not delivered.
+var errDuplicate = errors.New("duplicate torrent")
+
+// Describes the handling of torrents that have already been delivered.
+type DuplicatesConfig struct {
+	Store  string `json:"store"`  // Store file (default ~/.local/share/gutterd/torrents.json).
+	Action string `json:"action"` // skip (default), move or deliver.
+	Dir    string `json:"dir"`    // Destination of duplicates (move only).
+}
+
+func (dc *DuplicatesConfig) Validate() error {
+	switch dc.Action {
+	case "", "skip", "deliver":
+	case "move":
+		if dc.Dir == "" {
+			return fmt.Errorf("duplicates: no dir for move action")
+		}
+		stat, err := os.Stat(dc.Dir)
+		if err != nil {
+			return fmt.Errorf("duplicates: %v", err)
+		}
+		if !stat.IsDir() {
+			return fmt.Errorf("duplicates: dir is not a directory: %s", dc.Dir)
+		}
+	default:
+		return fmt.Errorf("duplicates: unknown action %q", dc.Action)
+	}
+	return nil
+}
+
+// Returns the path of the store, applying the default.
+func (dc *DuplicatesConfig) StorePath() (string, error) {
+	if dc.Store != "" {
+		return dc.Store, nil
+	}
+	data := os.Getenv("XDG_DATA_HOME")
+	if data == "" {
+		home, err := HomeDirectory()
+		if err != nil {
+			return "", err
+		}
+		data = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(data, "gutterd", "torrents.json"), nil
+}
+
+var (
+	dedupe    *store.Store // Routed torrents; nil if duplicates are not detected.
+	dedupeMut sync.Mutex   // Guards dedupe.
+)
+
+// Open the store configured by c, if it differs from the current one.
+func openStore(c *Config) error {
+	s, err := loadStore(c)
+	if err != nil {
+		return err
+	}
+	setStore(s)
+	return nil
+}
+
+// Returns the store configured by c without making it current. The current
+// store is returned if it is the one configured.
+func loadStore(c *Config) (*store.Store, error) {
+	if c.Duplicates == nil {
+		return nil, nil
+	}
+	path, err := c.Duplicates.StorePath()
+	if err != nil {
+		return nil, err
+	}
+	if s := currentStore(); s != nil && s.Path() == path {
+		return s, nil
+	}
+	return store.Open(path)
+}
+
+func setStore(s *store.Store) {
+	dedupeMut.Lock()
+	defer dedupeMut.Unlock()
+	dedupe = s
+}
+
+func currentStore() *store.Store {
+	dedupeMut.Lock()
+	defer dedupeMut.Unlock()
+	return dedupe
+}
+
+// Returns the key of torrent in the store, or an empty string if its
+// info-hash is not known.
+func storeKey(torrent *metadata.Metadata) string {
+	if hash := torrent.InfoHash(); hash != "" {
+		return hash
+	}
+	return torrent.InfoHashV2()
+}
+
+// Apply the duplicates policy to the file at path if torrent was delivered
+// previously. If the file should not be delivered, errDuplicate is returned.
+// A file left in place by the action that delivered it is not removed or
+// moved when it is seen again.
+func checkDuplicate(path string, torrent *metadata.Metadata) error {
+	config, _ := currentConfig()
+	s := currentStore()
+	key := storeKey(torrent)
+	if s == nil || config.Duplicates == nil || key == "" {
+		return nil
+	}
+	record, ok := s.Get(key)
+	if !ok {
+		return nil
+	}
+	statsd.Incr("torrent.duplicate", 1, 1)
+	glog.Warningf("duplicate torrent file:%q hash:%s previous:%q handler:%q time:%v",
+		torrent.Info.Name, key, record.Path, record.Handler, record.Time.Format(time.RFC3339))
+	switch {
+	case record.Kept && filepath.Clean(record.Path) == filepath.Clean(path):
+		glog.Infof("leaving delivered torrent in place (%q)", path)
+	case config.Duplicates.Action == "deliver":
+		return nil
+	case config.Duplicates.Action == "move":
+		if _, err := handler.MoveInto(path, config.Duplicates.Dir); err != nil {
+			return fmt.Errorf("unable to move duplicate; %v", err)
+		}
+	default:
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("unable to remove duplicate; %v", err)
+		}
+	}
+	return errDuplicate
+}
+
+// Record the delivery of torrent by h.
+func recordDelivery(path string, torrent *metadata.Metadata, h *handler.Handler) {
+	s := currentStore()
+	key := storeKey(torrent)
+	if s == nil || key == "" {
+		return
+	}
+	err := s.Put(key, &store.Record{
+		Name:    torrent.Info.Name,
+		Path:    path,
+		Handler: h.Name,
+		Time:    time.Now(),
+		Kept:    h.KeepsSource(),
+	})
+	if err != nil {
+		glog.Errorf("unable to record delivery (%q); %v", torrent.Info.Name, err)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bmatsuo/gutterd/handler"
+	"github.com/bmatsuo/gutterd/metadata"
+)
+
+func TestDuplicates(t *testing.T) {
+	torrent, err := metadata.ReadMetadata([]byte(testTorrent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(c *Config) { config = c }(config)
+	defer setStore(nil)
+	for i, test := range []struct {
+		action string // Duplicates action.
+		keeps  bool   // The delivering handler leaves the source in place.
+		same   bool   // The duplicate is the delivered file itself.
+		err    error
+		exists bool // The duplicate is still in the download directory.
+		moved  bool // The duplicate is in the duplicates directory.
+	}{
+		{"", false, false, errDuplicate, false, false},
+		{"", true, false, errDuplicate, false, false},
+		{"", true, true, errDuplicate, true, false},
+		{"skip", false, true, errDuplicate, false, false},
+		{"move", false, false, errDuplicate, false, true},
+		{"move", true, true, errDuplicate, true, false},
+		{"deliver", false, false, nil, true, false},
+		{"deliver", true, true, errDuplicate, true, false},
+	} {
+		dir, err := ioutil.TempDir("", "gutterd-duplicates")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		dl, dup := filepath.Join(dir, "dl"), filepath.Join(dir, "dup")
+		for _, d := range []string{dl, dup} {
+			if err := os.Mkdir(d, 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		config = &Config{Duplicates: &DuplicatesConfig{
+			Store:  filepath.Join(dir, "torrents.json"),
+			Action: test.action,
+			Dir:    dup,
+		}}
+		if err := openStore(config); err != nil {
+			t.Fatal(err)
+		}
+
+		path := filepath.Join(dl, "a.torrent")
+		if err := ioutil.WriteFile(path, []byte(testTorrent), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := checkDuplicate(path, torrent); err != nil {
+			t.Errorf("Test %d: unrecorded torrent: %v", i, err)
+		}
+		action := handler.ActionConfig{}
+		if test.keeps {
+			action.Type = "copy"
+		}
+		delivered := path
+		if !test.same {
+			delivered = filepath.Join(dl, "b.torrent")
+		}
+		recordDelivery(delivered, torrent, handler.Config{Name: "h", Action: action}.Handler())
+
+		if err := checkDuplicate(path, torrent); err != test.err {
+			t.Errorf("Test %d: error %v (expected %v)", i, err, test.err)
+		}
+		if _, err := os.Stat(path); (err == nil) != test.exists {
+			t.Errorf("Test %d: exists %v (expected %v)", i, err == nil, test.exists)
+		}
+		if _, err := os.Stat(filepath.Join(dup, "a.torrent")); (err == nil) != test.moved {
+			t.Errorf("Test %d: moved %v (expected %v)", i, err == nil, test.moved)
+		}
+	}
+}
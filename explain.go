@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bmatsuo/gutterd/handler"
+	"github.com/bmatsuo/gutterd/matcher"
+	"github.com/bmatsuo/gutterd/metadata"
+	"github.com/bmatsuo/gutterd/watcher"
+)
+
+// Explain how each file in paths would be handled without delivering it.
+// Every handler is tested and the result of each of its patterns is printed.
+// Files are assumed to come from the watch directory of config containing
+// them. False is returned if any file could not be read.
+func explain(w io.Writer, paths []string, handlers []*handler.Handler, config *Config) bool {
+	ok := true
+	for _, path := range paths {
+		torrent, err := metadata.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(w, "%s: error: %v\n\n", path, err)
+			ok = false
+			continue
+		}
+		fmt.Fprintf(w, "%s: %q", path, torrent.Info.Name)
+		if hash := torrent.InfoHash(); hash != "" {
+			fmt.Fprintf(w, " hash:%s", hash)
+		}
+		fmt.Fprintln(w)
+		source := sourceOf(config, path)
+		var match *handler.Handler
+		for _, h := range handlers {
+			results := h.Explain(torrent)
+			if source != nil && len(source.Handlers) > 0 || len(h.From) > 0 {
+				results = append([]*matcher.Result{sourceResult(h, source)}, results...)
+			}
+			status := "fail"
+			if allowed(h, source) && h.Match(torrent) {
+				status = "match"
+				if match == nil {
+					match = h
+				}
+			}
+			fmt.Fprintf(w, "  handler %q: %s\n", h.Name, status)
+			tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+			printResults(tw, "    ", results)
+			tw.Flush()
+		}
+		if match != nil {
+			fmt.Fprintf(w, "  => %q (watch %s)\n\n", match.Name, match.Watch)
+		} else {
+			fmt.Fprintf(w, "  => no handler matched\n\n")
+		}
+	}
+	return ok
+}
+
+// Returns the result of testing whether h may handle torrents from source.
+func sourceResult(h *handler.Handler, source *watcher.Config) *matcher.Result {
+	var patterns []string
+	if len(h.From) > 0 {
+		patterns = append(patterns, "from "+strings.Join(h.From, ", "))
+	}
+	if source != nil && len(source.Handlers) > 0 {
+		patterns = append(patterns, "handlers "+strings.Join(source.Handlers, ", "))
+	}
+	r := &matcher.Result{
+		Field:   "source",
+		Pattern: strings.Join(patterns, "; "),
+		Values:  []string{"unknown"},
+		Match:   allowed(h, source),
+	}
+	if source != nil {
+		r.Values = []string{source.Path}
+	}
+	return r
+}
+
+// Print results, indenting the results of nested matcher groups.
+func printResults(w io.Writer, indent string, results []*matcher.Result) {
+	for _, r := range results {
+		pass := "fail"
+		if r.Match {
+			pass = "pass"
+		}
+		if r.Results != nil || r.Pattern == "" {
+			fmt.Fprintf(w, "%s%s\t%s\n", indent, r.Field, pass)
+			printResults(w, indent+"  ", r.Results)
+			continue
+		}
+		fmt.Fprintf(w, "%s%s\t%s\t%q\t%s\n", indent, r.Field, pass, r.Pattern, quoteAll(r.Values))
+	}
+}
+
+func quoteAll(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = fmt.Sprintf("%q", v)
+	}
+	return "[" + strings.Join(quoted, " ") + "]"
+}
@@ -11,17 +11,16 @@ package main
  */
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/golang/glog"
-	"gopkg.in/fsnotify.v0"
 
 	"github.com/bmatsuo/gutterd/handler"
-	"github.com/bmatsuo/gutterd/metadata"
 	"github.com/bmatsuo/gutterd/statsd"
 	"github.com/bmatsuo/gutterd/watcher"
 )
@@ -31,6 +30,7 @@ var (
 	handlers []*handler.Handler // The ordered set of torrent handlers.
 	opt      *Options           // Command line options.
 	fs       *watcher.Watcher   // Filesystem event watcher
+	workers  *pool              // Handles torrent files concurrently.
 )
 
 func HomeDirectory() (home string, err error) {
@@ -40,48 +40,189 @@ func HomeDirectory() (home string, err error) {
 	return
 }
 
-// Handle a .torrent file.
-func handleFile(path string) {
-	torrent, err := metadata.ReadMetadataFile(path)
+// File extensions of handled files.
+var exts = []string{".torrent", ".magnet"}
+
+// Returns true if path has an extension in exts.
+func isTorrentFile(path string) bool {
+	for _, ext := range exts {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the file at path, found in the directory source, is handled.
+// Files with an extension in exts are always handled. Other files, such as
+// text files containing magnet links, are handled when source has a pattern
+// (which they matched), unless gutterd renamed them to be left alone.
+func isHandled(source *watcher.Config, path string) bool {
+	if isTorrentFile(path) {
+		return true
+	}
+	if source == nil || source.Pattern == "" {
+		return false
+	}
+	return !strings.HasSuffix(path, handler.HandledSuffix) &&
+		!strings.HasSuffix(path, unmatchedSuffix)
+}
+
+// Handle a .torrent or .magnet file. The matching handler is returned, or nil
+// if no handler matched the torrent. Files are not handled once ctx is done.
+func handleFile(ctx context.Context, path string) (*handler.Handler, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	torrent, err := readFile(ctx, path)
 	if err != nil {
 		statsd.Incr("torrent.error", 1, 1)
 		glog.Errorf("error reading torrent (%q); %v", path, err)
-		return
+		return nil, err
+	}
+	if key := storeKey(torrent); key != "" {
+		torrentLock.lock(key)
+		defer torrentLock.unlock(key)
+	}
+	if err := checkDuplicate(path, torrent); err != nil {
+		if err != errDuplicate {
+			glog.Errorf("duplicate handling failed (%q); %v", torrent.Info.Name, err)
+		}
+		return nil, err
 	}
 	// Find the first handler matching the supplied torrent.
+	config, handlers := currentConfig()
+	source := sourceOf(config, path)
 	for _, handler := range handlers {
+		if !allowed(handler, source) {
+			continue
+		}
 		if handler.Match(torrent) {
 			name := "torrent.match." + handler.Name
 			statsd.Incr(name, 1, 1)
-			glog.Infof("match file:%q handler:%q watch:%q",
+			glog.Infof("match file:%q hash:%s handler:%q watch:%q",
 				torrent.Info.Name,
+				torrent.InfoHash(),
 				handler.Name,
 				handler.Watch,
 			)
-			mvpath := filepath.Join(handler.Watch, filepath.Base(path))
-			if err := os.Rename(path, mvpath); err != nil {
+			if err := handler.DeliverMarked(ctx, path, torrent); err != nil {
 				glog.Errorf("watch import failed (%q); %v", torrent.Info.Name, err)
+				return handler, err
 			}
-			return
+			recordDelivery(path, torrent, handler)
+			return handler, nil
 		}
 	}
 	statsd.Incr("torrent.no-match", 1, 1)
 	glog.Warningf("no handler matched torrent: %q", torrent.Info.Name)
+	handleUnmatched(path)
+	return nil, nil
+}
+
+// Returns true if h may handle torrents found in source. Handlers restricted
+// to particular watch directories do not handle torrents of unknown source.
+func allowed(h *handler.Handler, source *watcher.Config) bool {
+	if source == nil {
+		return len(h.From) == 0
+	}
+	return source.Allows(h.Name) && h.HandlesFrom(source.Path)
+}
+
+// Returns the watched or polled directory containing the file at path, or nil.
+// When directories are nested the innermost one is returned.
+func sourceOf(config *Config, path string) *watcher.Config {
+	var source *watcher.Config
+	dirs := append(append([]watcher.Config(nil), config.Watch...), config.Poll...)
+	for i := range dirs {
+		if !dirs[i].Contains(filepath.Dir(path)) {
+			continue
+		}
+		if source == nil || len(filepath.Clean(dirs[i].Path)) > len(filepath.Clean(source.Path)) {
+			source = &dirs[i]
+		}
+	}
+	return source
 }
 
-func signalHandler() {
-	sig := make(chan os.Signal, 2)
-	signal.Notify(sig, os.Interrupt)
-	for _ = range sig {
-		fs.Close()
+// Handle .torrent and .magnet files already present in the watched and polled
+// directories, e.g. those downloaded while the deamon was not running. Files
+// are handled by the worker pool and sweep returns once all are handled, or
+// when ctx is done.
+func sweep(ctx context.Context) {
+	var matched, unmatched, duplicates, errors int64
+	var mut sync.Mutex
+	var wg sync.WaitGroup
+	done := func(handler *handler.Handler, err error) {
+		defer wg.Done()
+		mut.Lock()
+		defer mut.Unlock()
+		switch {
+		case err == errDuplicate:
+			duplicates++
+		case err != nil:
+			errors++
+		case handler == nil:
+			unmatched++
+		default:
+			matched++
+		}
+	}
+	config, _ := currentConfig()
+	dirs := append(append([]watcher.Config(nil), config.Watch...), config.Poll...)
+	for _, dir := range dirs {
+		files, err := dir.Files()
+		if err != nil {
+			mut.Lock()
+			errors++
+			mut.Unlock()
+			glog.Errorf("sweep failed (%q); %v", dir, err)
+			continue
+		}
+		for _, path := range files {
+			if ctx.Err() != nil {
+				break
+			}
+			if !isHandled(sourceOf(config, path), path) {
+				continue
+			}
+			wg.Add(1)
+			if !workers.submit(path, done) {
+				wg.Done()
+			}
+		}
+	}
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		glog.Info("sweep interrupted")
+		return
 	}
+	mut.Lock()
+	defer mut.Unlock()
+	statsd.Incr("sweep.matched", matched, 1)
+	statsd.Incr("sweep.no-match", unmatched, 1)
+	statsd.Incr("sweep.duplicate", duplicates, 1)
+	statsd.Incr("sweep.error", errors, 1)
+	glog.Infof("sweep matched:%d unmatched:%d duplicates:%d errors:%d",
+		matched, unmatched, duplicates, errors)
 }
 
-func fsInit() (err error) {
-	fs, err = watcher.NewInstr(
-		func(event *fsnotify.FileEvent) bool {
+// Initialize the filesystem watcher. The watcher is closed when ctx is done.
+func fsInit(ctx context.Context) (err error) {
+	fs, err = watcher.NewInstrContext(ctx,
+		func(event *watcher.Event) bool {
 			statsd.Incr("watcher.fs.events", 1, 1) //  filter sees all events
-			return event.IsCreate() && strings.HasSuffix(event.Name, ".torrent")
+			if !event.IsCreate() {
+				return false
+			}
+			config, _ := currentConfig()
+			return isHandled(sourceOf(config, event.Name), event.Name)
 		},
 		func(err error) {
 			statsd.Incr("watcher.fs.errors", 1, 1)
@@ -91,9 +232,13 @@ func fsInit() (err error) {
 		return
 	}
 
+	setIntervals(config)
 	if err = fs.Watch(config.Watch...); err != nil {
 		return
 	}
+	if err = fs.Poll(config.Poll...); err != nil {
+		return
+	}
 
 	return
 }
@@ -115,6 +260,14 @@ func main() {
 		glog.Fatalf("unable to load configuration: %v", err)
 	}
 
+	if opt.DryRun {
+		applyOptions(config)
+		if !explain(os.Stdout, opt.Files, config.MakeHandlers(), config) {
+			os.Exit(1)
+		}
+		return
+	}
+
 	if config.Statsd != "" {
 		err := statsd.Init(config.Statsd, "gutterd")
 		if err != nil {
@@ -124,19 +277,44 @@ func main() {
 	}
 
 	handlers = config.MakeHandlers()
+	if err := openStore(config); err != nil {
+		glog.Fatalf("unable to open torrent store: %v", err)
+	}
 
 	// command line flag overrides
-	if opt.Watch != nil {
-		config.Watch = opt.Watch
-	}
+	applyOptions(config)
 
 	statsd.Incr("proc.boot", 1, 1)
 
-	if err := fsInit(); err != nil {
+	// Watchers stop when ctx is done. Queued files are handled until work is
+	// done, which happens only if they are not handled before the shutdown
+	// timeout.
+	ctx, shutdown := context.WithCancel(context.Background())
+	work, stopWork := context.WithCancel(context.Background())
+	if err := fsInit(ctx); err != nil {
 		glog.Fatalf("error initializing file system watcher; %v", err)
 	}
+	// Reloads replace config once signals are handled.
+	boot := config
+	go signalHandler(shutdown)
+	if boot.WatchConfig {
+		if err := watchConfig(ctx, opt.ConfigPath); err != nil {
+			glog.Warningf("unable to watch configuration file; %v", err)
+		}
+	}
+	workers = newPool(work, boot.workers())
+	// Sweep concurrently so that watcher events are not held up by files
+	// waiting to be retried. The sweep must stop submitting before the pool
+	// is drained.
+	swept := make(chan struct{})
+	go func() {
+		sweep(ctx)
+		close(swept)
+	}()
 	for event := range fs.Event {
 		statsd.Incr("torrents.matches", 1, 1)
-		handleFile(event.Name)
+		workers.submit(event.Name, nil)
 	}
+	<-swept
+	exit(drain(stopWork))
 }
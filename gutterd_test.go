@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bmatsuo/gutterd/handler"
+	"github.com/bmatsuo/gutterd/watcher"
+)
+
+const testTorrent = "d8:announce17:http://a/announce4:infod6:lengthi1e4:name5:a.iso" +
+	"12:piece lengthi1e6:pieces20:aaaaaaaaaaaaaaaaaaaaee"
+
+func TestHandleFileFrom(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gutterd-handle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dl, other, out := filepath.Join(dir, "dl"), filepath.Join(dir, "other"), filepath.Join(dir, "out")
+	for _, d := range []string{dl, other, out} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer func(c *Config, h []*handler.Handler) { config, handlers = c, h }(config, handlers)
+	config = &Config{Watch: []watcher.Config{watcher.Dir(dl + "/"), watcher.Dir(other)}}
+	config.Handlers = []handler.Config{{Name: "dl", Watch: out, From: []string{dl}}}
+	handlers = config.MakeHandlers()
+
+	for i, test := range []struct {
+		dir   string
+		match bool
+	}{
+		{dl, true},
+		{other, false},
+	} {
+		path := filepath.Join(test.dir, "a.torrent")
+		if err := ioutil.WriteFile(path, []byte(testTorrent), 0644); err != nil {
+			t.Fatal(err)
+		}
+		h, err := handleFile(context.Background(), path)
+		if err != nil {
+			t.Errorf("Test %d: %v", i, err)
+			continue
+		}
+		if (h != nil) != test.match {
+			t.Errorf("Test %d: handler %v, expected match %v", i, h, test.match)
+		}
+		_, err = os.Stat(filepath.Join(out, "a.torrent"))
+		if delivered := err == nil; delivered != test.match {
+			t.Errorf("Test %d: delivered %v, expected %v", i, delivered, test.match)
+		}
+		os.Remove(filepath.Join(out, "a.torrent"))
+	}
+}
+
+func TestHandleFileKeepsSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gutterd-handle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dl, out := filepath.Join(dir, "dl"), filepath.Join(dir, "out")
+	for _, d := range []string{dl, out} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer func(c *Config, h []*handler.Handler) { config, handlers = c, h }(config, handlers)
+	config = &Config{
+		Watch:      []watcher.Config{watcher.Dir(dl)},
+		Duplicates: &DuplicatesConfig{Store: filepath.Join(dir, "torrents.json")},
+	}
+	config.Handlers = []handler.Config{{Name: "copy", Watch: out, Action: handler.ActionConfig{Type: "copy"}}}
+	handlers = config.MakeHandlers()
+	if err := openStore(config); err != nil {
+		t.Fatal(err)
+	}
+	defer setStore(nil)
+
+	path := filepath.Join(dl, "a.torrent")
+	if err := ioutil.WriteFile(path, []byte(testTorrent), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if h, err := handleFile(context.Background(), path); h == nil || err != nil {
+		t.Fatalf("handler %v; %v", h, err)
+	}
+	for _, p := range []string{path + handler.HandledSuffix, filepath.Join(out, "a.torrent")} {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("%v", err)
+		}
+	}
+	if isTorrentFile(path + handler.HandledSuffix) {
+		t.Errorf("kept source would be swept again")
+	}
+}
+
+func TestIsHandled(t *testing.T) {
+	plain := &watcher.Config{Path: "/dl"}
+	text := &watcher.Config{Path: "/dl", Pattern: "*"}
+	for i, test := range []struct {
+		source *watcher.Config
+		path   string
+		expect bool
+	}{
+		{nil, "/dl/a.torrent", true},
+		{nil, "/dl/a.txt", false},
+		{plain, "/dl/a.magnet", true},
+		{plain, "/dl/a.txt", false},
+		{text, "/dl/a.txt", true},
+		{text, "/dl/a.txt" + handler.HandledSuffix, false},
+		{text, "/dl/a.txt" + unmatchedSuffix, false},
+	} {
+		if ok := isHandled(test.source, test.path); ok != test.expect {
+			t.Errorf("Test %d: %q handled %v (expected %v)", i, test.path, ok, test.expect)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/bmatsuo/gutterd/metadata"
+)
+
+// A Delivery describes a matched .torrent file. Its fields are available to
+// exec action command templates (e.g. {{.Path}}).
+type Delivery struct {
+	Path    string             // Path of the .torrent file.
+	Name    string             // Name of the torrent (file or directory).
+	Handler string             // Name of the matching handler.
+	Watch   string             // Watch directory of the matching handler.
+	Dest    string             // Path of the .torrent file within Watch.
+	Torrent *metadata.Metadata // Torrent metadata.
+}
+
+// An Action delivers matched .torrent files to a BitTorrent client. Actions
+// that take time give up when ctx is done.
+type Action interface {
+	Deliver(ctx context.Context, d *Delivery) error
+}
+
+// Moves the .torrent file to d.Dest, copying it if d.Dest is on another
+// device.
+type MoveAction struct{}
+
+func (MoveAction) Deliver(ctx context.Context, d *Delivery) error { return MoveFile(d.Path, d.Dest) }
+
+// Copies the .torrent file to d.Dest.
+type CopyAction struct{}
+
+func (CopyAction) Deliver(ctx context.Context, d *Delivery) error { return copyFile(d.Path, d.Dest) }
+
+// Creates a symbolic link to the .torrent file at d.Dest.
+type SymlinkAction struct{}
+
+func (SymlinkAction) Deliver(ctx context.Context, d *Delivery) error {
+	path, err := filepath.Abs(d.Path)
+	if err != nil {
+		return err
+	}
+	return os.Symlink(path, d.Dest)
+}
+
+// Creates a hard link to the .torrent file at d.Dest.
+type HardlinkAction struct{}
+
+func (HardlinkAction) Deliver(ctx context.Context, d *Delivery) error { return os.Link(d.Path, d.Dest) }
+
+// Runs a command. Each argument is a template executed with the Delivery. The
+// command is killed if the context is done before it exits.
+type ExecAction struct {
+	Command []*template.Template
+}
+
+func (a *ExecAction) Deliver(ctx context.Context, d *Delivery) error {
+	args := make([]string, len(a.Command))
+	for i, t := range a.Command {
+		buf := new(bytes.Buffer)
+		if err := t.Execute(buf, d); err != nil {
+			return err
+		}
+		args[i] = buf.String()
+	}
+	out, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %v: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+type ActionConfig struct {
+	Type    string   `json:"type"`    // move (default), copy, symlink, hardlink or exec.
+	Command []string `json:"command"` // Command templates (exec only).
+}
+
+func (ac ActionConfig) Action() Action {
+	a, err := ac.action()
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+func (ac ActionConfig) action() (Action, error) {
+	switch ac.Type {
+	case "", "move":
+		return MoveAction{}, nil
+	case "copy":
+		return CopyAction{}, nil
+	case "symlink":
+		return SymlinkAction{}, nil
+	case "hardlink":
+		return HardlinkAction{}, nil
+	case "exec":
+		if len(ac.Command) == 0 {
+			return nil, fmt.Errorf("exec action: no command")
+		}
+		a := &ExecAction{Command: make([]*template.Template, len(ac.Command))}
+		for i, arg := range ac.Command {
+			t, err := template.New(arg).Parse(arg)
+			if err != nil {
+				return nil, fmt.Errorf("exec action: %v", err)
+			}
+			a.Command[i] = t
+		}
+		return a, nil
+	}
+	return nil, fmt.Errorf("unknown action type: %q", ac.Type)
+}
+
+func (ac ActionConfig) Validate() error {
+	_, err := ac.action()
+	return err
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bmatsuo/gutterd/metadata"
+)
+
+func TestActions(t *testing.T) {
+	for i, test := range []struct {
+		config ActionConfig
+		keep   bool // source remains after delivery
+	}{
+		{ActionConfig{}, false},
+		{ActionConfig{Type: "move"}, false},
+		{ActionConfig{Type: "copy"}, true},
+		{ActionConfig{Type: "symlink"}, true},
+		{ActionConfig{Type: "hardlink"}, true},
+		{ActionConfig{Type: "exec", Command: []string{"cp", "{{.Path}}", "{{.Watch}}/{{.Name}}.torrent"}}, true},
+	} {
+		for _, mark := range []bool{false, true} {
+			testAction(t, i, test.config, test.keep, mark)
+		}
+	}
+}
+
+// Deliver a .torrent file with config and check the destination and source.
+func testAction(t *testing.T, i int, config ActionConfig, keep, mark bool) {
+	dir, err := ioutil.TempDir("", "gutterd-action")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "foo.torrent")
+	watch := filepath.Join(dir, "watch")
+	if err := os.Mkdir(watch, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(src, []byte("d4:infoe"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	h := Config{Name: "test", Watch: watch, Action: config}.Handler()
+	torrent := &metadata.Metadata{Info: &metadata.TorrentInfo{Name: "foo"}}
+	deliver := h.Deliver
+	if mark {
+		deliver = h.DeliverMarked
+	}
+	if err := deliver(context.Background(), src, torrent); err != nil {
+		t.Errorf("Test %d: delivery error: %v", i, err)
+		return
+	}
+	p, err := ioutil.ReadFile(filepath.Join(watch, "foo.torrent"))
+	if err != nil {
+		t.Errorf("Test %d: %v", i, err)
+	} else if string(p) != "d4:infoe" {
+		t.Errorf("Test %d: unexpected content: %q", i, p)
+	}
+	if mark {
+		src += HandledSuffix
+	}
+	if _, err := os.Stat(src); (err == nil) != keep {
+		t.Errorf("Test %d: unexpected source state (mark %v): %v", i, mark, err)
+	}
+}
+
+func TestExecActionContext(t *testing.T) {
+	a := ActionConfig{Type: "exec", Command: []string{"sleep", "10"}}.Action()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := a.Deliver(ctx, &Delivery{}); err == nil {
+		t.Errorf("expected error")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("command not killed when the context was done")
+	}
+}
+
+func TestActionConfigValidate(t *testing.T) {
+	for i, test := range []struct {
+		config ActionConfig
+		valid  bool
+	}{
+		{ActionConfig{Type: "copy"}, true},
+		{ActionConfig{Type: "teleport"}, false},
+		{ActionConfig{Type: "exec"}, false},
+		{ActionConfig{Type: "exec", Command: []string{"echo", "{{.Path"}}, false},
+		{ActionConfig{Type: "exec", Command: []string{"echo", "{{.Path}}"}}, true},
+	} {
+		if err := test.config.Validate(); (err == nil) != test.valid {
+			t.Errorf("Test %d: unexpected validation result: %v", i, err)
+		}
+	}
+}
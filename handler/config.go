@@ -9,12 +9,16 @@ import (
 )
 
 type Config struct {
-	Name  string         `json:"name"`  // A name for logging purposes.
-	Watch string         `json:"watch"` // Matching .torrent file destination.
-	Match matcher.Config `json:"match"` // Describes .torrent files to handle.
+	Name   string         `json:"name"`   // A name for logging purposes.
+	Watch  string         `json:"watch"`  // Matching .torrent file destination.
+	Match  matcher.Config `json:"match"`  // Describes .torrent files to handle.
+	Action ActionConfig   `json:"action"` // Delivers .torrent files (default move).
+	From   []string       `json:"from"`   // Watch directories of handled torrents.
 }
 
-func (c Config) Handler() *Handler { return &Handler{c.Name, c.Watch, c.Match.Matcher()} }
+func (c Config) Handler() *Handler {
+	return &Handler{c.Name, c.Watch, c.Match.Matcher(), c.Action.Action(), c.From}
+}
 
 func (hc Config) Validate() error {
 	if hc.Name == "" {
@@ -34,5 +38,9 @@ func (hc Config) Validate() error {
 	if err != nil {
 		return fmt.Errorf("handler %q: %v", hc.Name, err)
 	}
+	err = hc.Action.Validate()
+	if err != nil {
+		return fmt.Errorf("handler %q: %v", hc.Name, err)
+	}
 	return nil
 }
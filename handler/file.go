@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// MoveFile renames src to dst. When src and dst are on different devices the
+// file is copied to dst atomically and src is removed.
+func MoveFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if !isCrossDevice(err) {
+		return err
+	}
+	if err := copyFile(src, dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// MoveInto moves src into dir without replacing an existing file. If the name
+// of src is taken, a number is added to it (e.g. "a (1).torrent"). Names for
+// which dest+suffix exists for one of sidecars are skipped as well. The path
+// of the moved file is returned.
+func MoveInto(src, dir string, sidecars ...string) (string, error) {
+	base := filepath.Base(src)
+	ext := filepath.Ext(base)
+	name := strings.TrimSuffix(base, ext)
+	for n := 0; ; n++ {
+		dest := filepath.Join(dir, base)
+		if n > 0 {
+			dest = filepath.Join(dir, fmt.Sprintf("%s (%d)%s", name, n, ext))
+		}
+		if taken(dest, sidecars) {
+			continue
+		}
+		// Reserve dest; the move replaces the empty placeholder.
+		f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		f.Close()
+		if err := MoveFile(src, dest); err != nil {
+			os.Remove(dest)
+			return "", err
+		}
+		return dest, nil
+	}
+}
+
+// Returns true if path+suffix exists for one of suffixes.
+func taken(path string, suffixes []string) bool {
+	for _, suffix := range suffixes {
+		if _, err := os.Lstat(path + suffix); !os.IsNotExist(err) {
+			return true
+		}
+	}
+	return false
+}
+
+func isCrossDevice(err error) bool {
+	if lerr, ok := err.(*os.LinkError); ok {
+		return lerr.Err == syscall.EXDEV
+	}
+	return false
+}
+
+// copyFile copies src into a temporary file in the directory of dst, syncs
+// it, and renames it to dst. Readers of dst never see a partial file.
+func copyFile(src, dst string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	stat, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	// A dot-prefixed name is ignored by clients watching for *.torrent files.
+	tmp, err := ioutil.TempFile(filepath.Dir(dst), ".gutterd-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err = io.Copy(tmp, in); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(stat.Mode().Perm()); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
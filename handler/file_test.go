@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gutterd-copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src.torrent")
+	dst := filepath.Join(dir, "dst.torrent")
+	if err := ioutil.WriteFile(src, []byte("d4:infoe"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyFile(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	stat, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Mode().Perm() != 0640 {
+		t.Errorf("unexpected mode: %v", stat.Mode())
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 {
+		t.Errorf("temporary files remain: %d entries", len(infos))
+	}
+	if err := copyFile(filepath.Join(dir, "missing"), dst); err == nil {
+		t.Errorf("expected error copying missing file")
+	}
+}
+
+func TestMoveInto(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gutterd-move")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dest := filepath.Join(dir, "dest")
+	if err := os.Mkdir(dest, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dest, "a (1).torrent.error.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for i, expect := range []string{"a.torrent", "a (2).torrent", "a (3).torrent"} {
+		src := filepath.Join(dir, "a.torrent")
+		content := []byte{byte('0' + i)}
+		if err := ioutil.WriteFile(src, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		path, err := MoveInto(src, dest, ".error.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if path != filepath.Join(dest, expect) {
+			t.Errorf("Test %d: moved to %s (expected %s)", i, path, expect)
+		}
+		if p, err := ioutil.ReadFile(path); err != nil || string(p) != string(content) {
+			t.Errorf("Test %d: unexpected content %q; %v", i, p, err)
+		}
+	}
+	if _, err := MoveInto(filepath.Join(dir, "missing"), dest); err == nil {
+		t.Errorf("expected error moving missing file")
+	}
+	if _, err := os.Stat(filepath.Join(dest, "missing")); !os.IsNotExist(err) {
+		t.Errorf("placeholder left behind")
+	}
+}
@@ -1,13 +1,80 @@
 package handler
 
-import "github.com/bmatsuo/gutterd/matcher"
+import (
+	"context"
+	"os"
+	"path/filepath"
 
-// A Handler type's only function is to move matching torrents into
+	"github.com/bmatsuo/gutterd/matcher"
+	"github.com/bmatsuo/gutterd/metadata"
+)
+
+// A Handler type's only function is to deliver matching torrents into
 // media-specific client watch directories.
 type Handler struct {
-	Name     string // Unique name for the Handler.
-	Watch    string // Destination for .torrent files (watched by a client).
-	*matcher.Matcher        // Acts as a Matcher.
+	Name            string   // Unique name for the Handler.
+	Watch           string   // Destination for .torrent files (watched by a client).
+	matcher.Matcher          // Acts as a Matcher.
+	Action          Action   // Delivers matching .torrent files.
+	From            []string // Watch directories of handled torrents (empty for any).
 }
 
 func (h *Handler) String() string { return h.Name }
+
+// Returns true if h handles torrents found in the watch directory dir.
+func (h *Handler) HandlesFrom(dir string) bool {
+	if len(h.From) == 0 {
+		return true
+	}
+	for _, from := range h.From {
+		if filepath.Clean(from) == filepath.Clean(dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// The suffix appended to .torrent files that are left in place by an action.
+const HandledSuffix = ".handled"
+
+// Returns true if h.Action leaves .torrent files in place.
+func (h *Handler) KeepsSource() bool {
+	_, moves := h.Action.(MoveAction)
+	return !moves
+}
+
+// Deliver the .torrent file at path using h.Action. Delivery is abandoned when
+// ctx is done.
+func (h *Handler) Deliver(ctx context.Context, path string, torrent *metadata.Metadata) error {
+	return h.Action.Deliver(ctx, h.delivery(path, filepath.Base(path), torrent))
+}
+
+// Like Deliver, but if h.Action leaves the .torrent file in place the file is
+// first renamed with HandledSuffix, so that it is not handled again. The file
+// is delivered from its new path under its original name, and is renamed back
+// if delivery fails.
+func (h *Handler) DeliverMarked(ctx context.Context, path string, torrent *metadata.Metadata) error {
+	if !h.KeepsSource() {
+		return h.Deliver(ctx, path, torrent)
+	}
+	marked := path + HandledSuffix
+	if err := os.Rename(path, marked); err != nil {
+		return err
+	}
+	err := h.Action.Deliver(ctx, h.delivery(marked, filepath.Base(path), torrent))
+	if err != nil {
+		os.Rename(marked, path)
+	}
+	return err
+}
+
+func (h *Handler) delivery(path, name string, torrent *metadata.Metadata) *Delivery {
+	return &Delivery{
+		Path:    path,
+		Name:    torrent.Info.Name,
+		Handler: h.Name,
+		Watch:   h.Watch,
+		Dest:    filepath.Join(h.Watch, name),
+		Torrent: torrent,
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/golang/glog"
+
+	"github.com/bmatsuo/gutterd/handler"
+	"github.com/bmatsuo/gutterd/metadata"
+	"github.com/bmatsuo/gutterd/statsd"
+)
+
+// The default delay before reading an unparseable file a second time.
+const defaultRetryDelay = 5 * time.Second
+
+// The suffix of the sidecar files describing quarantined files.
+const errorSuffix = ".error.txt"
+
+// Describes the handling of files that cannot be parsed.
+type InvalidConfig struct {
+	Dir        string `json:"dir"`        // Destination of invalid files.
+	RetryDelay int64  `json:"retryDelay"` // Seconds before retrying (default 5, negative disables).
+}
+
+func (ic *InvalidConfig) Validate() error {
+	if ic.Dir == "" {
+		return fmt.Errorf("invalid: no dir")
+	}
+	stat, err := os.Stat(ic.Dir)
+	if err != nil {
+		return fmt.Errorf("invalid: %v", err)
+	}
+	if !stat.IsDir() {
+		return fmt.Errorf("invalid: dir is not a directory: %s", ic.Dir)
+	}
+	return nil
+}
+
+func (ic *InvalidConfig) retryDelay() time.Duration {
+	if ic.RetryDelay == 0 {
+		return defaultRetryDelay
+	}
+	return time.Duration(ic.RetryDelay) * time.Second
+}
+
+// Read the file at path. Files that cannot be parsed are often still being
+// written, so when the configuration has an invalid section they are read
+// again after a delay. Files that still cannot be parsed are moved to the
+// invalid directory along with a .error.txt file describing the error.
+func readFile(ctx context.Context, path string) (*metadata.Metadata, error) {
+	torrent, err := metadata.ReadFile(path)
+	config, _ := currentConfig()
+	if err == nil || config.Invalid == nil || os.IsNotExist(err) {
+		return torrent, err
+	}
+	if delay := config.Invalid.retryDelay(); delay > 0 {
+		glog.Infof("retrying unreadable torrent in %v (%q); %v", delay, path, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		torrent, err = metadata.ReadFile(path)
+		if err == nil || os.IsNotExist(err) {
+			return torrent, err
+		}
+	}
+	statsd.Incr("torrent.invalid", 1, 1)
+	if qerr := quarantine(config.Invalid.Dir, path, err); qerr != nil {
+		glog.Errorf("unable to quarantine invalid torrent (%q); %v", path, qerr)
+	}
+	return nil, err
+}
+
+// Move the file at path into dir and write the error that made it invalid to
+// a sidecar file. Existing files in dir are not replaced.
+func quarantine(dir, path string, reason error) error {
+	dest, err := handler.MoveInto(path, dir, errorSuffix)
+	if err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("path: %s\ntime: %s\nerror: %v\n",
+		path, time.Now().Format(time.RFC3339), reason)
+	return ioutil.WriteFile(dest+errorSuffix, []byte(msg), 0644)
+}
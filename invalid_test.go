@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadFile(t *testing.T) {
+	defer func(c *Config) { config = c }(config)
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i, test := range []struct {
+		invalid *InvalidConfig
+		ctx     context.Context
+		write   bool   // Write a broken file.
+		fix     bool   // Fix the file during the retry delay.
+		ok      bool   // The file is read.
+		dl, inv string // Files left in the download and invalid directories.
+	}{
+		{nil, context.Background(), true, false, false, "bad.torrent", ""},
+		{&InvalidConfig{RetryDelay: -1}, context.Background(), true, false, false, "", "bad.torrent bad.torrent.error.txt"},
+		{&InvalidConfig{RetryDelay: -1}, context.Background(), false, false, false, "", ""},
+		{&InvalidConfig{RetryDelay: 1}, context.Background(), true, true, true, "bad.torrent", ""},
+		{&InvalidConfig{RetryDelay: 1}, canceled, true, false, false, "bad.torrent", ""},
+	} {
+		dir, err := ioutil.TempDir("", "gutterd-invalid")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		dl, inv := filepath.Join(dir, "dl"), filepath.Join(dir, "inv")
+		for _, d := range []string{dl, inv} {
+			if err := os.Mkdir(d, 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if test.invalid != nil {
+			test.invalid.Dir = inv
+		}
+		config = &Config{Invalid: test.invalid}
+
+		path := filepath.Join(dl, "bad.torrent")
+		if test.write {
+			if err := ioutil.WriteFile(path, []byte("d8:announce"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if test.fix {
+			time.AfterFunc(100*time.Millisecond, func() {
+				ioutil.WriteFile(path, []byte(testTorrent), 0644)
+			})
+		}
+		torrent, err := readFile(test.ctx, path)
+		if (err == nil) != test.ok {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+		}
+		if test.ok && torrent.Info.Name != "a.iso" {
+			t.Errorf("Test %d: unexpected torrent %q", i, torrent.Info.Name)
+		}
+		if !test.write && !os.IsNotExist(err) {
+			t.Errorf("Test %d: expected not-exist error: %v", i, err)
+		}
+		if names := dirNames(t, dl); names != test.dl {
+			t.Errorf("Test %d: download directory %q (expected %q)", i, names, test.dl)
+		}
+		if names := dirNames(t, inv); names != test.inv {
+			t.Errorf("Test %d: invalid directory %q (expected %q)", i, names, test.inv)
+		}
+		if strings.Contains(test.inv, errorSuffix) {
+			p, err := ioutil.ReadFile(filepath.Join(inv, "bad.torrent"+errorSuffix))
+			if err != nil || !strings.Contains(string(p), "path: "+path) {
+				t.Errorf("Test %d: unexpected sidecar %q; %v", i, p, err)
+			}
+		}
+	}
+}
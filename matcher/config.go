@@ -2,8 +2,10 @@ package matcher
 
 import (
 	"fmt"
+	"reflect"
 	"regexp"
 	"strings"
+	"time"
 	"unicode"
 )
 
@@ -32,43 +34,159 @@ func regexpCompile(s string) (r *regexp.Regexp, err error) {
 	return regexp.Compile(normalized)
 }
 
-func regexpMustCompile(s string) *regexp.Regexp {
-	r, err := regexpCompile(s)
-	if err != nil {
-		panic(err)
-	}
-	return r
-}
-
 type Config struct {
-	Tracker  string `json:"tracker"`  // Matched tracker urls.
-	Basename string `json:"basename"` // Matched (root) file basenames.
-	Ext      string `json:"ext"`      // Matched (nested-)file extensions.
+	Tracker        Pattern `json:"tracker"`        // Matched tracker urls.
+	PrimaryTracker bool    `json:"primaryTracker"` // Ignore the announce-list.
+	Basename       Pattern `json:"basename"`       // Matched (root) file basenames.
+	Ext            Pattern `json:"ext"`            // Matched (nested-)file extensions.
+	ExtMode        string  `json:"extMode"`        // any (default), all, majority or largest.
+	InfoHash       Pattern `json:"infoHash"`       // Matched hex info-hashes (v1 or v2).
+	Path           Pattern `json:"path"`           // Matched relative file paths.
+	PathMode       string  `json:"pathMode"`       // any (default) or all.
+
+	// Numeric constraints. Zero values are ignored.
+	MinSize        Size `json:"minSize"`        // Minimum total length.
+	MaxSize        Size `json:"maxSize"`        // Maximum total length.
+	MinFileSize    Size `json:"minFileSize"`    // Minimum length of the largest file.
+	MaxFileSize    Size `json:"maxFileSize"`    // Maximum length of the largest file.
+	MinFiles       int  `json:"minFiles"`       // Minimum number of files.
+	MaxFiles       int  `json:"maxFiles"`       // Maximum number of files.
+	MinPieceLength Size `json:"minPieceLength"` // Minimum piece length.
+	MaxPieceLength Size `json:"maxPieceLength"` // Maximum piece length.
+
+	Private       *bool    `json:"private"`       // Matched private flag.
+	Comment       Pattern  `json:"comment"`       // Matched comments.
+	CreatedBy     Pattern  `json:"createdBy"`     // Matched "created by" values.
+	CreatedAfter  Date     `json:"createdAfter"`  // Minimum creation date.
+	CreatedBefore Date     `json:"createdBefore"` // Maximum creation date.
+	MaxAge        Duration `json:"maxAge"`        // Maximum time since creation.
+
+	All []Config `json:"all"` // Nested matchers that must all match.
+	Any []Config `json:"any"` // Nested matchers of which one must match.
+	Not *Config  `json:"not"` // A nested matcher that must not match.
 }
 
-func (mc Config) Matcher() *Matcher {
-	m := new(Matcher)
-	if mc.Tracker != "" {
-		m.Tracker = regexpMustCompile(mc.Tracker)
+// Returns true if mc has any nested matchers.
+func (mc Config) isGroup() bool { return mc.All != nil || mc.Any != nil || mc.Not != nil }
+
+// Returns a Matcher for mc. Nested matchers and the rules of mc itself must
+// all match.
+func (mc Config) Matcher() Matcher {
+	if !mc.isGroup() {
+		return mc.Rules()
+	}
+	var all All
+	rules := mc
+	rules.All, rules.Any, rules.Not = nil, nil, nil
+	if !reflect.DeepEqual(rules, Config{}) {
+		all = append(all, rules.Rules())
+	}
+	for _, c := range mc.All {
+		all = append(all, c.Matcher())
 	}
-	if mc.Basename != "" {
-		m.Basename = regexpMustCompile(mc.Basename)
+	if mc.Any != nil {
+		var any Any
+		for _, c := range mc.Any {
+			any = append(any, c.Matcher())
+		}
+		all = append(all, any)
 	}
-	if mc.Ext != "" {
-		m.Ext = regexpMustCompile(mc.Ext)
+	if mc.Not != nil {
+		all = append(all, Not{mc.Not.Matcher()})
 	}
+	if len(all) == 1 {
+		return all[0]
+	}
+	return all
+}
+
+// Returns the Rules of mc, ignoring nested matchers.
+func (mc Config) Rules() *Rules {
+	m := new(Rules)
+	m.Tracker = mc.Tracker.MustCompile()
+	m.PrimaryTracker = mc.PrimaryTracker
+	m.Basename = mc.Basename.MustCompile()
+	m.Ext = mc.Ext.MustCompile()
+	m.ExtMode = ExtMode(mc.ExtMode)
+	m.InfoHash = mc.InfoHash.MustCompile()
+	m.Path = mc.Path.MustCompile()
+	m.PathAll = mc.PathMode == "all"
+	m.Size = Range{int64(mc.MinSize), int64(mc.MaxSize)}
+	m.FileSize = Range{int64(mc.MinFileSize), int64(mc.MaxFileSize)}
+	m.Files = Range{int64(mc.MinFiles), int64(mc.MaxFiles)}
+	m.PieceLength = Range{int64(mc.MinPieceLength), int64(mc.MaxPieceLength)}
+	m.Private = mc.Private
+	m.Comment = mc.Comment.MustCompile()
+	m.CreatedBy = mc.CreatedBy.MustCompile()
+	m.CreatedAfter = mc.CreatedAfter.Time
+	m.CreatedBefore = mc.CreatedBefore.Time
+	m.MaxAge = time.Duration(mc.MaxAge)
 	return m
 }
 
 func (mc Config) Validate() error {
-	if _, err := regexpCompile(mc.Tracker); err != nil {
-		return fmt.Errorf("Matcher tracker: %v", err)
+	for _, p := range []struct {
+		name    string
+		pattern Pattern
+	}{
+		{"tracker", mc.Tracker},
+		{"basename", mc.Basename},
+		{"ext", mc.Ext},
+		{"infoHash", mc.InfoHash},
+		{"path", mc.Path},
+		{"comment", mc.Comment},
+		{"createdBy", mc.CreatedBy},
+	} {
+		if _, err := p.pattern.Compile(); err != nil {
+			return fmt.Errorf("Matcher %s: %v", p.name, err)
+		}
+	}
+	switch ExtMode(mc.ExtMode) {
+	case "", ExtAny, ExtAll, ExtMajority, ExtLargest:
+	default:
+		return fmt.Errorf("Matcher extMode: unknown mode %q", mc.ExtMode)
+	}
+	switch mc.PathMode {
+	case "", "any", "all":
+	default:
+		return fmt.Errorf("Matcher pathMode: unknown mode %q", mc.PathMode)
+	}
+	for _, r := range []struct {
+		name     string
+		min, max int64
+	}{
+		{"size", int64(mc.MinSize), int64(mc.MaxSize)},
+		{"fileSize", int64(mc.MinFileSize), int64(mc.MaxFileSize)},
+		{"files", int64(mc.MinFiles), int64(mc.MaxFiles)},
+		{"pieceLength", int64(mc.MinPieceLength), int64(mc.MaxPieceLength)},
+	} {
+		if r.min < 0 || r.max < 0 {
+			return fmt.Errorf("Matcher %s: negative bound", r.name)
+		}
+		if r.max > 0 && r.min > r.max {
+			return fmt.Errorf("Matcher %s: minimum exceeds maximum", r.name)
+		}
+	}
+	if mc.MaxAge < 0 {
+		return fmt.Errorf("Matcher maxAge: negative duration")
+	}
+	for i, c := range mc.All {
+		if err := c.Validate(); err != nil {
+			return fmt.Errorf("all[%d]: %v", i, err)
+		}
+	}
+	if mc.Any != nil && len(mc.Any) == 0 {
+		return fmt.Errorf("Matcher any: empty")
 	}
-	if _, err := regexpCompile(mc.Basename); err != nil {
-		return fmt.Errorf("Matcher basename: %v", err)
+	for i, c := range mc.Any {
+		if err := c.Validate(); err != nil {
+			return fmt.Errorf("any[%d]: %v", i, err)
+		}
 	}
-	if _, err := regexpCompile(mc.Ext); err != nil {
-		return fmt.Errorf("Matcher ext: %v", err)
+	if mc.Not != nil {
+		if err := mc.Not.Validate(); err != nil {
+			return fmt.Errorf("not: %v", err)
+		}
 	}
 	return nil
 }
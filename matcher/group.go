@@ -0,0 +1,70 @@
+package matcher
+
+import (
+	"github.com/bmatsuo/gutterd/metadata"
+)
+
+// Returns a single Result for m. Multiple results are grouped under "all".
+func explain(m Matcher, torrent *metadata.Metadata) *Result {
+	results := m.Explain(torrent)
+	if len(results) == 1 {
+		return results[0]
+	}
+	return &Result{Field: "all", Match: m.Match(torrent), Results: results}
+}
+
+// A Matcher that matches torrents matched by every one of its Matchers.
+type All []Matcher
+
+func (all All) Match(torrent *metadata.Metadata) bool {
+	for _, m := range all {
+		if !m.Match(torrent) {
+			return false
+		}
+	}
+	return true
+}
+
+func (all All) Explain(torrent *metadata.Metadata) []*Result {
+	result := &Result{Field: "all", Match: true}
+	for _, m := range all {
+		r := explain(m, torrent)
+		result.Results = append(result.Results, r)
+		result.Match = result.Match && r.Match
+	}
+	return []*Result{result}
+}
+
+// A Matcher that matches torrents matched by any one of its Matchers.
+type Any []Matcher
+
+func (any Any) Match(torrent *metadata.Metadata) bool {
+	for _, m := range any {
+		if m.Match(torrent) {
+			return true
+		}
+	}
+	return false
+}
+
+func (any Any) Explain(torrent *metadata.Metadata) []*Result {
+	result := &Result{Field: "any"}
+	for _, m := range any {
+		r := explain(m, torrent)
+		result.Results = append(result.Results, r)
+		result.Match = result.Match || r.Match
+	}
+	return []*Result{result}
+}
+
+// A Matcher that matches torrents not matched by its Matcher.
+type Not struct {
+	Matcher
+}
+
+func (not Not) Match(torrent *metadata.Metadata) bool { return !not.Matcher.Match(torrent) }
+
+func (not Not) Explain(torrent *metadata.Metadata) []*Result {
+	r := explain(not.Matcher, torrent)
+	return []*Result{{Field: "not", Match: !r.Match, Results: []*Result{r}}}
+}
@@ -11,52 +11,307 @@ package matcher
  */
 
 import (
+	"fmt"
 	"path/filepath"
 	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/bmatsuo/gutterd/metadata"
 )
 
-// Matched against torrents (Metadata) by Handler types.
-type Matcher struct {
-	Tracker  *regexp.Regexp
-	Basename *regexp.Regexp
-	Ext      *regexp.Regexp
+// A Matcher tests torrents (Metadata) for Handler types.
+type Matcher interface {
+	// Match returns true if torrent satisfies the Matcher.
+	Match(torrent *metadata.Metadata) bool
+	// Explain returns the result of each test performed by the Matcher.
+	Explain(torrent *metadata.Metadata) []*Result
+}
+
+// A Matcher that tests torrent fields against patterns and ranges.
+type Rules struct {
+	Tracker        *regexp.Regexp
+	PrimaryTracker bool // Match Tracker against the announce url only.
+	Basename       *regexp.Regexp
+	Ext            *regexp.Regexp
+	ExtMode        ExtMode        // How Ext is applied to multiple files.
+	InfoHash       *regexp.Regexp // Matched against v1 and v2 hex info-hashes.
+	Path           *regexp.Regexp // Matched against slash-separated file paths.
+	PathAll        bool           // Path must match every file, not just one.
+	Size           Range          // Total length in bytes.
+	FileSize       Range          // Length in bytes of the largest file.
+	Files          Range          // Number of files.
+	PieceLength    Range          // Piece length in bytes.
+	Private        *bool          // Matched against the private flag, if non-nil.
+	Comment        *regexp.Regexp
+	CreatedBy      *regexp.Regexp
+	CreatedAfter   time.Time     // Ignored if zero.
+	CreatedBefore  time.Time     // Ignored if zero.
+	MaxAge         time.Duration // Ignored if zero.
+}
+
+// Determines which files of a multi-file torrent must have an extension
+// matching Rules.Ext.
+type ExtMode string
+
+const (
+	ExtAny      ExtMode = "any"      // Any file (the default).
+	ExtAll      ExtMode = "all"      // Every file.
+	ExtMajority ExtMode = "majority" // Files making up more than half of the total length.
+	ExtLargest  ExtMode = "largest"  // The largest file.
+)
+
+// An inclusive range of integers. Zero bounds are ignored.
+type Range struct {
+	Min, Max int64
+}
+
+// Returns true if either bound of r is set.
+func (r Range) IsSet() bool { return r.Min != 0 || r.Max != 0 }
+
+// Returns true if n is within r.
+func (r Range) Contains(n int64) bool {
+	return (r.Min == 0 || n >= r.Min) && (r.Max == 0 || n <= r.Max)
+}
+
+// Formats r using format for each bound (e.g. ">= 1, <= 4").
+func (r Range) format(format func(int64) string) string {
+	var bounds []string
+	if r.Min != 0 {
+		bounds = append(bounds, ">= "+format(r.Min))
+	}
+	if r.Max != 0 {
+		bounds = append(bounds, "<= "+format(r.Max))
+	}
+	return strings.Join(bounds, ", ")
 }
 
 // Match a torrent against the patterns of m. If all non-nil patterns match the
-// corresponding fields in torrent, then the method returns true.
-func (m *Matcher) Match(torrent *metadata.Metadata) bool {
-	if m.Tracker != nil {
-		if !m.Tracker.MatchString(torrent.Announce) {
-			return false
+// corresponding fields in torrent, and the fields are within all set ranges,
+// then the method returns true. Unless
+// m.PrimaryTracker is true, the Tracker pattern matches if it matches any url
+// in the torrent's announce-list.
+func (m *Rules) Match(torrent *metadata.Metadata) bool {
+	match := true
+	m.each(torrent, func(result *Result) bool {
+		match = result.Match
+		return match
+	})
+	return match
+}
+
+// The outcome of testing one pattern of a Matcher against a torrent.
+type Result struct {
+	Field   string    // The tested field (e.g. "tracker").
+	Pattern string    // The pattern tested.
+	Values  []string  // Torrent values tested. The pattern must match one.
+	Match   bool      // True if the pattern matched.
+	Results []*Result // Results of nested matchers (groups only).
+}
+
+// Explain tests every non-nil pattern of m against torrent. Unlike Match, it
+// does not stop at the first pattern that fails.
+func (m *Rules) Explain(torrent *metadata.Metadata) []*Result {
+	var results []*Result
+	m.each(torrent, func(result *Result) bool {
+		results = append(results, result)
+		return true
+	})
+	return results
+}
+
+// Tests each non-nil pattern and set range of m against torrent in turn,
+// passing the results to report. Testing stops when report returns false.
+func (m *Rules) each(torrent *metadata.Metadata, report func(*Result) bool) {
+	test := func(field string, r *regexp.Regexp, values func() []string) func() *Result {
+		return func() *Result {
+			if r == nil {
+				return nil
+			}
+			result := &Result{Field: field, Pattern: r.String(), Values: values()}
+			for _, v := range result.Values {
+				if r.MatchString(v) {
+					result.Match = true
+				}
+			}
+			return result
 		}
 	}
-	if m.Ext != nil {
-		var exts []string
-		if torrent.Info.SingleFileMode() {
-			exts = append(exts, filepath.Ext(torrent.Info.Name))
-		} else {
-			for _, file := range torrent.Info.Files {
-				path := file.Path
-				exts = append(exts, filepath.Ext(path[len(path)-1]))
+	formatSize := func(n int64) string { return Size(n).String() }
+	formatInt := func(n int64) string { return strconv.FormatInt(n, 10) }
+	testRange := func(field string, r Range, n func() int64, format func(int64) string) func() *Result {
+		return func() *Result {
+			if !r.IsSet() {
+				return nil
+			}
+			v := n()
+			return &Result{
+				Field:   field,
+				Pattern: r.format(format),
+				Values:  []string{format(v)},
+				Match:   r.Contains(v),
 			}
 		}
-		matches := false
-		for _, ext := range exts {
-			if m.Ext.MatchString(ext) {
-				matches = true
+	}
+	tests := []func() *Result{
+		test("tracker", m.Tracker, func() []string {
+			if m.PrimaryTracker {
+				return []string{torrent.Announce}
+			}
+			return torrent.Trackers()
+		}),
+		func() *Result {
+			if m.Ext == nil {
+				return nil
+			}
+			return m.testExt(torrent)
+		},
+		test("basename", m.Basename, func() []string { return []string{filepath.Base(torrent.Info.Name)} }),
+		test("infoHash", m.InfoHash, func() []string {
+			var hashes []string
+			for _, hash := range []string{torrent.InfoHash(), torrent.InfoHashV2()} {
+				if hash != "" {
+					hashes = append(hashes, hash)
+				}
+			}
+			return hashes
+		}),
+		func() *Result {
+			if m.Path == nil {
+				return nil
+			}
+			return m.testPath(torrent)
+		},
+		testRange("size", m.Size, torrent.Info.TotalLength, formatSize),
+		testRange("fileSize", m.FileSize, torrent.Info.MaxFileLength, formatSize),
+		testRange("files", m.Files, func() int64 { return int64(torrent.Info.NumFiles()) }, formatInt),
+		testRange("pieceLength", m.PieceLength, func() int64 { return torrent.Info.PieceLength }, formatSize),
+		func() *Result {
+			if m.Private == nil {
+				return nil
 			}
+			return &Result{
+				Field:   "private",
+				Pattern: strconv.FormatBool(*m.Private),
+				Values:  []string{strconv.FormatBool(torrent.Info.Private)},
+				Match:   *m.Private == torrent.Info.Private,
+			}
+		},
+		test("comment", m.Comment, func() []string { return []string{torrent.Comment} }),
+		test("createdBy", m.CreatedBy, func() []string { return []string{torrent.CreatedBy} }),
+	}
+	for _, t := range tests {
+		if result := t(); result != nil && !report(result) {
+			return
+		}
+	}
+	m.testCreated(torrent, report)
+}
+
+// Tests the creation date of torrent against m.CreatedAfter, m.CreatedBefore,
+// and m.MaxAge. Torrents without a creation date fail all date constraints.
+// Testing stops when report returns false.
+func (m *Rules) testCreated(torrent *metadata.Metadata, report func(*Result) bool) {
+	created := time.Unix(torrent.CreationDate, 0)
+	value := created.UTC().Format(time.RFC3339)
+	if torrent.CreationDate == 0 {
+		value = "unknown"
+	}
+	test := func(field, pattern string, ok bool) bool {
+		return report(&Result{
+			Field:   field,
+			Pattern: pattern,
+			Values:  []string{value},
+			Match:   torrent.CreationDate != 0 && ok,
+		})
+	}
+	if !m.CreatedAfter.IsZero() {
+		if !test("createdAfter", m.CreatedAfter.Format(time.RFC3339), created.After(m.CreatedAfter)) {
+			return
+		}
+	}
+	if !m.CreatedBefore.IsZero() {
+		if !test("createdBefore", m.CreatedBefore.Format(time.RFC3339), created.Before(m.CreatedBefore)) {
+			return
+		}
+	}
+	if m.MaxAge != 0 {
+		test("maxAge", m.MaxAge.String(), now().Sub(created) <= m.MaxAge)
+	}
+}
+
+// Tests the path of each file in torrent, relative to the torrent's root
+// directory, against m.Path. The path of a single-file torrent is its name.
+func (m *Rules) testPath(torrent *metadata.Metadata) *Result {
+	result := &Result{Field: "path", Pattern: m.Path.String()}
+	if m.PathAll {
+		result.Field = "path (all)"
+	}
+	paths := []string{torrent.Info.Name}
+	if !torrent.Info.SingleFileMode() {
+		paths = paths[:0]
+		for _, file := range torrent.Info.Files {
+			paths = append(paths, strings.Join(file.Path, "/"))
 		}
-		if !matches {
-			return false
+	}
+	result.Values = paths
+	result.Match = m.PathAll && len(paths) > 0
+	for _, path := range paths {
+		if m.PathAll {
+			result.Match = result.Match && m.Path.MatchString(path)
+		} else {
+			result.Match = result.Match || m.Path.MatchString(path)
 		}
 	}
-	if m.Basename != nil {
-		basename := filepath.Base(torrent.Info.Name)
-		if !m.Basename.MatchString(basename) {
-			return false
+	return result
+}
+
+// Tests the extensions of files in torrent against m.Ext according to
+// m.ExtMode.
+func (m *Rules) testExt(torrent *metadata.Metadata) *Result {
+	result := &Result{Field: "ext", Pattern: m.Ext.String()}
+	if m.ExtMode != "" && m.ExtMode != ExtAny {
+		result.Field = "ext (" + string(m.ExtMode) + ")"
+	}
+	files := torrent.Info.Files
+	if torrent.Info.SingleFileMode() {
+		files = []*metadata.FileInfo{{Path: []string{torrent.Info.Name}, Length: torrent.Info.Length}}
+	}
+	ext := func(file *metadata.FileInfo) string { return filepath.Ext(file.Path[len(file.Path)-1]) }
+	switch m.ExtMode {
+	case ExtLargest:
+		var largest *metadata.FileInfo
+		for _, file := range files {
+			if largest == nil || file.Length > largest.Length {
+				largest = file
+			}
+		}
+		if largest != nil {
+			result.Values = []string{ext(largest)}
+			result.Match = m.Ext.MatchString(ext(largest))
+		}
+	case ExtMajority:
+		var matched, total int64
+		for _, file := range files {
+			total += file.Length
+			if m.Ext.MatchString(ext(file)) {
+				matched += file.Length
+			}
+		}
+		result.Values = []string{fmt.Sprintf("%v of %v", Size(matched), Size(total))}
+		result.Match = 2*matched > total
+	case ExtAll:
+		result.Match = len(files) > 0
+		for _, file := range files {
+			result.Values = append(result.Values, ext(file))
+			result.Match = result.Match && m.Ext.MatchString(ext(file))
+		}
+	default:
+		for _, file := range files {
+			result.Values = append(result.Values, ext(file))
+			result.Match = result.Match || m.Ext.MatchString(ext(file))
 		}
 	}
-	return true
+	return result
 }
@@ -7,11 +7,367 @@ package matcher
  */
 
 import (
-    "testing"
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/bmatsuo/gutterd/metadata"
 )
 
+var ubuntu = &metadata.Metadata{
+	Announce: "http://torrent.ubuntu.com:6969/announce",
+	AnnounceList: [][]string{
+		{"http://torrent.ubuntu.com:6969/announce"},
+		{"http://ipv6.torrent.ubuntu.com:6969/announce"},
+	},
+	Info: &metadata.TorrentInfo{
+		Name:   "ubuntu-14.04-desktop-amd64.iso",
+		Length: 1010827264,
+	},
+}
+
+var ubuntuMagnet, _ = metadata.ParseMagnet("magnet:?xt=urn:btih:c12fe1c06bba254a9dc9f519b335aa7c1367a88a&dn=ubuntu-14.04-desktop-amd64.iso")
+
+var season = &metadata.Metadata{
+	Announce:     "http://tracker.example.org/announce",
+	Comment:      "Uploaded by example",
+	CreatedBy:    "mktorrent 1.0",
+	CreationDate: 1400000000, // 2014-05-13T16:53:20Z
+	Info: &metadata.TorrentInfo{
+		Name:    "Show.S01",
+		Private: true,
+		Files: []*metadata.FileInfo{
+			{Path: []string{"Show.S01E01.mkv"}, Length: 1 << 30},
+			{Path: []string{"Show.S01E02.mkv"}, Length: 1 << 30},
+			{Path: []string{"Show.S01.nfo"}, Length: 1 << 10},
+		},
+	},
+}
+
+var disc = &metadata.Metadata{
+	Announce: "http://tracker.example.org/announce",
+	Info: &metadata.TorrentInfo{
+		Name: "Movie",
+		Files: []*metadata.FileInfo{
+			{Path: []string{"BDMV", "index.bdmv"}, Length: 1 << 10},
+			{Path: []string{"BDMV", "STREAM", "00000.m2ts"}, Length: 20 << 30},
+			{Path: []string{"CERTIFICATE", "id.bdmv"}, Length: 1 << 10},
+		},
+	},
+}
+
+var matcherTests = []struct {
+	config  Config
+	torrent *metadata.Metadata
+	match   bool
+}{
+	{Config{}, ubuntu, true},
+	{Config{Tracker: Regex(`ubuntu[.]com`)}, ubuntu, true},
+	{Config{Tracker: Regex(`archlinux`)}, ubuntu, false},
+	{Config{Tracker: Regex(`ipv6`)}, ubuntu, true},
+	{Config{Tracker: Regex(`ipv6`), PrimaryTracker: true}, ubuntu, false},
+	{Config{Basename: Regex(`^ubuntu`), Ext: Regex(`[.]iso`)}, ubuntu, true},
+	{Config{Ext: Regex(`[.]mkv`)}, season, true},
+	{Config{Ext: Regex(`[.]iso`)}, season, false},
+	{Config{Ext: Regex(`[.]nfo`)}, season, true},
+	{Config{Ext: Regex(`[.]nfo`), ExtMode: "all"}, season, false},
+	{Config{Ext: Regex(`[.](mkv|nfo)`), ExtMode: "all"}, season, true},
+	{Config{Ext: Regex(`[.]nfo`), ExtMode: "largest"}, season, false},
+	{Config{Ext: Regex(`[.]mkv`), ExtMode: "largest"}, season, true},
+	{Config{Ext: Regex(`[.]nfo`), ExtMode: "majority"}, season, false},
+	{Config{Ext: Regex(`[.]mkv`), ExtMode: "majority"}, season, true},
+	{Config{Ext: Regex(`[.]iso`), ExtMode: "largest"}, ubuntu, true},
+	{Config{Ext: Regex(`[.]iso`), ExtMode: "majority"}, ubuntu, true},
+	{Config{Path: Regex(`^BDMV/`)}, disc, true},
+	{Config{Path: Regex(`^BDMV/`)}, season, false},
+	{Config{Path: Regex(`^BDMV/`), PathMode: "all"}, disc, false},
+	{Config{Path: Regex(`[.](bdmv|m2ts)$`), PathMode: "all"}, disc, true},
+	{Config{Path: Pattern{Glob: `BDMV/**`}}, disc, true},
+	{Config{Path: Pattern{Glob: `**/*.m2ts`}}, disc, true},
+	{Config{Path: Pattern{Glob: `*.m2ts`}}, disc, false},
+	{Config{Path: Pattern{Glob: `*.iso`}}, ubuntu, true},
+	{Config{InfoHash: Regex(`^c12fe1c0`)}, ubuntuMagnet, true},
+	{Config{InfoHash: Regex(`^0000`)}, ubuntuMagnet, false},
+	{Config{InfoHash: Regex(`^c12fe1c0`)}, season, false},
+	{Config{MinSize: 2 << 30}, season, true},
+	{Config{MinSize: 3 << 30}, season, false},
+	{Config{MaxSize: 1 << 30}, ubuntu, true},
+	{Config{MinFileSize: 1 << 30, MaxFileSize: 1 << 30}, season, true},
+	{Config{MaxFileSize: 1 << 20}, season, false},
+	{Config{MinFiles: 2}, season, true},
+	{Config{MinFiles: 2}, ubuntu, false},
+	{Config{MaxFiles: 2}, season, false},
+	{Config{MinPieceLength: 1 << 20}, ubuntu, false},
+	{Config{Private: &yes}, season, true},
+	{Config{Private: &no}, season, false},
+	{Config{Private: &no}, ubuntu, true},
+	{Config{Comment: Regex(`example`), CreatedBy: Regex(`^mktorrent`)}, season, true},
+	{Config{Comment: Regex(`example`)}, ubuntu, false},
+	{Config{CreatedAfter: date("2014-01-01")}, season, true},
+	{Config{CreatedAfter: date("2014-06-01")}, season, false},
+	{Config{CreatedBefore: date("2014-06-01")}, season, true},
+	{Config{CreatedBefore: date("2014-06-01")}, ubuntu, false},
+	{Config{MaxAge: Duration(30 * 24 * time.Hour)}, season, true},
+	{Config{MaxAge: Duration(24 * time.Hour)}, season, false},
+}
+
+var yes, no = true, false
+
+func date(s string) Date {
+	d, err := ParseDate(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
 
 func TestMatcher(t *testing.T) {
+	now = func() time.Time { return time.Unix(1400000000, 0).Add(7 * 24 * time.Hour) }
+	defer func() { now = time.Now }()
+	for i, test := range matcherTests {
+		if err := test.config.Validate(); err != nil {
+			t.Errorf("Test %d: invalid config: %v", i, err)
+			continue
+		}
+		if match := test.config.Matcher().Match(test.torrent); match != test.match {
+			t.Errorf("Test %d: match %v (expected %v)", i, match, test.match)
+		}
+	}
+	if err := (Config{Ext: Regex(`[.]mkv`), ExtMode: "most"}).Validate(); err == nil {
+		t.Errorf("expected error for unknown extMode")
+	}
+}
+
+func TestExplain(t *testing.T) {
+	m := Config{Tracker: Regex(`ubuntu[.]com`), Ext: Regex(`[.]mkv`)}.Matcher()
+	results := m.Explain(ubuntu)
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results; got %d", len(results))
+	}
+	if r := results[0]; r.Field != "tracker" || !r.Match || len(r.Values) != 2 {
+		t.Errorf("unexpected tracker result: %#v", r)
+	}
+	if r := results[1]; r.Field != "ext" || r.Match || r.Values[0] != ".iso" {
+		t.Errorf("unexpected ext result: %#v", r)
+	}
+}
 
+func TestMatchStops(t *testing.T) {
+	calls := 0
+	now = func() time.Time { calls++; return time.Now() }
+	defer func() { now = time.Now }()
+	m := &Rules{Tracker: regexp.MustCompile(`debian[.]org`), MaxAge: time.Hour}
+	if m.Match(ubuntu) {
+		t.Errorf("unexpected match")
+	}
+	if calls != 0 {
+		t.Errorf("match tested maxAge after tracker failed")
+	}
+	if results := m.Explain(ubuntu); len(results) != 2 || calls != 1 {
+		t.Errorf("explain did not test every rule: %d results", len(results))
+	}
 }
 
+func TestParseSize(t *testing.T) {
+	for _, test := range []struct {
+		s    string
+		size Size
+	}{
+		{"0", 0},
+		{"512", 512},
+		{"512B", 512},
+		{"4GiB", 4 << 30},
+		{"4 gib", 4 << 30},
+		{"1.5MiB", 3 << 19},
+		{"700MB", 700e6},
+		{"2k", 2 << 10},
+	} {
+		size, err := ParseSize(test.s)
+		if err != nil {
+			t.Errorf("%q: %v", test.s, err)
+		} else if size != test.size {
+			t.Errorf("%q: %d (expected %d)", test.s, size, test.size)
+		}
+	}
+	for _, s := range []string{"", "GiB", "-1", "4XB"} {
+		if _, err := ParseSize(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
+
+func TestSizeJSON(t *testing.T) {
+	var c Config
+	err := json.Unmarshal([]byte(`{"minSize": "4GiB", "maxSize": 1024}`), &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.MinSize != 4<<30 || c.MaxSize != 1024 {
+		t.Errorf("unexpected sizes: %d %d", c.MinSize, c.MaxSize)
+	}
+	if c.Validate() == nil {
+		t.Errorf("expected validation error for min > max")
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	for _, test := range []struct {
+		s string
+		d time.Duration
+	}{
+		{"36h", 36 * time.Hour},
+		{"30d", 30 * 24 * time.Hour},
+		{"1.5d", 36 * time.Hour},
+		{"2w", 14 * 24 * time.Hour},
+	} {
+		d, err := ParseDuration(test.s)
+		if err != nil {
+			t.Errorf("%q: %v", test.s, err)
+		} else if time.Duration(d) != test.d {
+			t.Errorf("%q: %v (expected %v)", test.s, d, test.d)
+		}
+	}
+	for _, s := range []string{"", "d", "3x"} {
+		if _, err := ParseDuration(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
+
+var groupTests = []struct {
+	config  string
+	torrent *metadata.Metadata
+	match   bool
+}{
+	{`{"any": [{"tracker": "ubuntu"}, {"tracker": "example"}]}`, ubuntu, true},
+	{`{"any": [{"tracker": "ubuntu"}, {"tracker": "example"}]}`, season, true},
+	{`{"any": [{"tracker": "archlinux"}, {"tracker": "example"}]}`, ubuntu, false},
+	{`{"any": [{"tracker": "ubuntu"}, {"tracker": "example"}], "not": {"basename": "^Show"}}`, season, false},
+	{`{"any": [{"tracker": "ubuntu"}, {"tracker": "example"}], "not": {"basename": "^Show"}}`, ubuntu, true},
+	{`{"ext": "[.]iso", "all": [{"tracker": "ubuntu"}, {"maxFiles": 1}]}`, ubuntu, true},
+	{`{"ext": "[.]mkv", "all": [{"tracker": "ubuntu"}, {"maxFiles": 1}]}`, ubuntu, false},
+	{`{"not": {"not": {"private": true}}}`, season, true},
+}
+
+func TestGroups(t *testing.T) {
+	for i, test := range groupTests {
+		var c Config
+		if err := json.Unmarshal([]byte(test.config), &c); err != nil {
+			t.Errorf("Test %d: %v", i, err)
+			continue
+		}
+		if err := c.Validate(); err != nil {
+			t.Errorf("Test %d: invalid config: %v", i, err)
+			continue
+		}
+		m := c.Matcher()
+		if match := m.Match(test.torrent); match != test.match {
+			t.Errorf("Test %d: match %v (expected %v)", i, match, test.match)
+		}
+		results := m.Explain(test.torrent)
+		match := true
+		for _, r := range results {
+			match = match && r.Match
+		}
+		if match != test.match {
+			t.Errorf("Test %d: explained match %v (expected %v)", i, match, test.match)
+		}
+	}
+
+	if err := (Config{Any: []Config{}}).Validate(); err == nil {
+		t.Errorf("expected error for empty any")
+	}
+	if err := (Config{Not: &Config{Tracker: Regex("(")}}).Validate(); err == nil {
+		t.Errorf("expected error for invalid nested pattern")
+	}
+}
+
+func TestGlob(t *testing.T) {
+	for _, test := range []struct {
+		glob  string
+		path  string
+		match bool
+	}{
+		{"*.iso", "ubuntu.iso", true},
+		{"*.iso", "dir/ubuntu.iso", false},
+		{"**.iso", "dir/ubuntu.iso", true},
+		{"**/*.iso", "ubuntu.iso", true},
+		{"**/*.iso", "a/b/ubuntu.iso", true},
+		{"BDMV/*", "BDMV/index.bdmv", true},
+		{"BDMV/*", "BDMV/STREAM/00000.m2ts", false},
+		{"CD?/*", "CD2/track.flac", true},
+		{"[Ss]eason*/*", "season 01/e01.mkv", true},
+		{"[!S]*", "Season", false},
+		{"a.b", "aXb", false},
+		{`\*`, "*", true},
+	} {
+		r, err := Pattern{Glob: test.glob}.Compile()
+		if err != nil {
+			t.Errorf("%q: %v", test.glob, err)
+			continue
+		}
+		if match := r.MatchString(test.path); match != test.match {
+			t.Errorf("%q %q: match %v (expected %v)", test.glob, test.path, match, test.match)
+		}
+	}
+	if _, err := (Pattern{Glob: "[abc"}).Compile(); err == nil {
+		t.Errorf("expected error for unterminated class")
+	}
+}
+
+func TestPattern(t *testing.T) {
+	for i, test := range []struct {
+		json    string
+		matches []string
+		fails   []string
+	}{
+		{`"[.]iso"`, []string{"ubuntu.iso"}, []string{"ubuntu.ISO", "ubuntu_iso"}},
+		{`{"regex": "[.]iso", "ignoreCase": true}`, []string{"ubuntu.ISO"}, []string{"ubuntu.img"}},
+		{`{"glob": "*.iso"}`, []string{".iso", "ubuntu.iso"}, []string{"ubuntu.iso.txt", "dir/ubuntu.iso"}},
+		{`{"glob": "*.ISO", "ignoreCase": true}`, []string{"ubuntu.iso"}, []string{"ubuntu.img"}},
+		{`{"literal": "ubuntu.com"}`, []string{"http://torrent.ubuntu.com/announce"}, []string{"http://ubuntuxcom/"}},
+		{`{"glob": "**tracker.org**"}`, []string{"http://tracker.org/announce", "udp://tracker.org:80"}, []string{"http://tracker.net/announce"}},
+		{`{"glob": "*tracker.org*"}`, []string{"tracker.org"}, []string{"http://tracker.org/announce"}},
+		{`[{"literal": "ubuntu.com"}, {"glob": "*.org"}]`, []string{"ubuntu.com", "debian.org"}, []string{"example.net"}},
+		{`["^a", {"literal": "B", "ignoreCase": true}]`, []string{"abc", "xbx"}, []string{"cat"}},
+	} {
+		var p Pattern
+		if err := json.Unmarshal([]byte(test.json), &p); err != nil {
+			t.Errorf("Test %d: %v", i, err)
+			continue
+		}
+		r, err := p.Compile()
+		if err != nil {
+			t.Errorf("Test %d: %v", i, err)
+			continue
+		}
+		for _, s := range test.matches {
+			if !r.MatchString(s) {
+				t.Errorf("Test %d: %q did not match", i, s)
+			}
+		}
+		for _, s := range test.fails {
+			if r.MatchString(s) {
+				t.Errorf("Test %d: %q matched", i, s)
+			}
+		}
+	}
+	for _, s := range []string{
+		`{"glob": "*.iso", "literal": "iso"}`,
+		`{"ignoreCase": true}`,
+		`{"regex": ""}`,
+		`{"glog": "*.iso"}`,
+		`{"regex": "("}`,
+		`[{"literal": "iso"}, {}]`,
+	} {
+		var p Pattern
+		err := json.Unmarshal([]byte(s), &p)
+		if err == nil {
+			_, err = p.Compile()
+		}
+		if err == nil {
+			t.Errorf("%s: expected error", s)
+		}
+	}
+}
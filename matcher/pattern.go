@@ -0,0 +1,121 @@
+package matcher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// A Pattern matches strings. In JSON a Pattern is either a regular expression
+// string, an object with one of the keys "regex", "glob" or "literal" (and
+// optionally "ignoreCase"), or a list of patterns of which any may match.
+//
+//	"[.]iso"
+//	{"glob": "*.iso", "ignoreCase": true}
+//	[{"literal": "ubuntu.com"}, {"literal": "debian.org"}]
+//
+// Regular expressions and literals match anywhere in a string. Globs must
+// match the entire string (see globRegexp), so a glob matching part of a url,
+// such as a tracker's host, must use "**" to match the slashes around it.
+type Pattern struct {
+	Regex      string    `json:"regex"`
+	Glob       string    `json:"glob"`
+	Literal    string    `json:"literal"`
+	IgnoreCase bool      `json:"ignoreCase"`
+	Any        []Pattern `json:"-"` // Alternatives (JSON lists).
+}
+
+// Returns a regular expression Pattern.
+func Regex(expr string) Pattern { return Pattern{Regex: expr} }
+
+// Returns true if p has no patterns.
+func (p Pattern) IsZero() bool {
+	return p.Regex == "" && p.Glob == "" && p.Literal == "" && len(p.Any) == 0
+}
+
+func (p *Pattern) UnmarshalJSON(data []byte) error {
+	var expr string
+	if err := json.Unmarshal(data, &expr); err == nil {
+		*p = Pattern{Regex: expr}
+		return nil
+	}
+	var any []Pattern
+	if err := json.Unmarshal(data, &any); err == nil {
+		*p = Pattern{Any: any}
+		return nil
+	}
+	type pattern Pattern // Avoids recursive UnmarshalJSON calls.
+	var obj pattern
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&obj); err != nil {
+		return fmt.Errorf("invalid pattern %s; %v", data, err)
+	}
+	if Pattern(obj).IsZero() {
+		return fmt.Errorf("invalid pattern %s; no regex, glob or literal", data)
+	}
+	*p = Pattern(obj)
+	return nil
+}
+
+// Returns the source of a regular expression equivalent to p.
+func (p Pattern) expr() (string, error) {
+	if len(p.Any) > 0 {
+		if p.Regex != "" || p.Glob != "" || p.Literal != "" {
+			return "", fmt.Errorf("pattern list mixed with a pattern")
+		}
+		exprs := make([]string, len(p.Any))
+		for i, alt := range p.Any {
+			expr, err := alt.expr()
+			if err != nil {
+				return "", err
+			}
+			exprs[i] = "(?:" + expr + ")"
+		}
+		return strings.Join(exprs, "|"), nil
+	}
+	var expr string
+	switch {
+	case p.Regex != "" && p.Glob == "" && p.Literal == "":
+		r, err := regexpCompile(p.Regex) // Normalizes whitespace.
+		if err != nil {
+			return "", err
+		}
+		expr = r.String()
+	case p.Glob != "" && p.Regex == "" && p.Literal == "":
+		var err error
+		if expr, err = globRegexp(p.Glob); err != nil {
+			return "", err
+		}
+	case p.Literal != "" && p.Regex == "" && p.Glob == "":
+		expr = regexp.QuoteMeta(p.Literal)
+	default:
+		return "", fmt.Errorf("pattern must have exactly one of regex, glob or literal")
+	}
+	if p.IgnoreCase {
+		expr = "(?i:" + expr + ")"
+	}
+	return expr, nil
+}
+
+// Compile p into a regular expression. A zero Pattern compiles to nil.
+func (p Pattern) Compile() (*regexp.Regexp, error) {
+	if p.IsZero() {
+		return nil, nil
+	}
+	expr, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	return regexp.Compile(expr)
+}
+
+func (p Pattern) MustCompile() *regexp.Regexp {
+	r, err := p.Compile()
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
@@ -0,0 +1,81 @@
+package matcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A Size is a number of bytes. In JSON it is either a number or a string with
+// an optional unit suffix, e.g. "700MB" or "4GiB". Unit prefixes are decimal
+// (kB, MB, GB, TB) or binary (KiB, MiB, GiB, TiB) and are case-insensitive.
+type Size int64
+
+var sizeUnits = []struct {
+	suffix string
+	scale  int64
+}{
+	{"kib", 1 << 10},
+	{"mib", 1 << 20},
+	{"gib", 1 << 30},
+	{"tib", 1 << 40},
+	{"kb", 1e3},
+	{"mb", 1e6},
+	{"gb", 1e9},
+	{"tb", 1e12},
+	{"k", 1 << 10},
+	{"m", 1 << 20},
+	{"g", 1 << 30},
+	{"t", 1 << 40},
+	{"b", 1},
+}
+
+// ParseSize parses a size with an optional unit suffix.
+func ParseSize(s string) (Size, error) {
+	str := strings.ToLower(strings.TrimSpace(s))
+	scale := int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(str, unit.suffix) {
+			str = strings.TrimSpace(str[:len(str)-len(unit.suffix)])
+			scale = unit.scale
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(str, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+	return Size(n * float64(scale)), nil
+}
+
+func (size *Size) UnmarshalJSON(p []byte) error {
+	var n int64
+	if err := json.Unmarshal(p, &n); err == nil {
+		*size = Size(n)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(p, &s); err != nil {
+		return fmt.Errorf("invalid size: %s", p)
+	}
+	var err error
+	*size, err = ParseSize(s)
+	return err
+}
+
+// Formats size using the largest binary unit it is at least one of.
+func (size Size) String() string {
+	for _, unit := range []struct {
+		suffix string
+		scale  int64
+	}{{"TiB", 1 << 40}, {"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10}} {
+		if int64(size) >= unit.scale {
+			if int64(size)%unit.scale == 0 {
+				return fmt.Sprintf("%d%s", int64(size)/unit.scale, unit.suffix)
+			}
+			return fmt.Sprintf("%.1f%s", float64(size)/float64(unit.scale), unit.suffix)
+		}
+	}
+	return fmt.Sprintf("%dB", int64(size))
+}
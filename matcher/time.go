@@ -0,0 +1,77 @@
+package matcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var now = time.Now // Replaced in tests.
+
+// A Date is a point in time. In JSON it is an RFC 3339 timestamp or a date of
+// the form "2006-01-02" (UTC).
+type Date struct {
+	time.Time
+}
+
+var dateLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"}
+
+// ParseDate parses an RFC 3339 timestamp or a date.
+func ParseDate(s string) (Date, error) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return Date{t}, nil
+		}
+	}
+	return Date{}, fmt.Errorf("invalid date: %q", s)
+}
+
+func (d *Date) UnmarshalJSON(p []byte) error {
+	var s string
+	if err := json.Unmarshal(p, &s); err != nil {
+		return fmt.Errorf("invalid date: %s", p)
+	}
+	var err error
+	*d, err = ParseDate(s)
+	return err
+}
+
+// A Duration is a length of time. In JSON it is a string accepted by
+// time.ParseDuration, or a number followed by "d" (days) or "w" (weeks),
+// e.g. "36h" or "30d".
+type Duration time.Duration
+
+// ParseDuration parses a duration, allowing units of days and weeks.
+func ParseDuration(s string) (Duration, error) {
+	for _, unit := range []struct {
+		suffix string
+		scale  time.Duration
+	}{{"d", 24 * time.Hour}, {"w", 7 * 24 * time.Hour}} {
+		if strings.HasSuffix(s, unit.suffix) {
+			n, err := strconv.ParseFloat(s[:len(s)-len(unit.suffix)], 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration: %q", s)
+			}
+			return Duration(n * float64(unit.scale)), nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration: %q", s)
+	}
+	return Duration(d), nil
+}
+
+func (d *Duration) UnmarshalJSON(p []byte) error {
+	var s string
+	if err := json.Unmarshal(p, &s); err != nil {
+		return fmt.Errorf("invalid duration: %s", p)
+	}
+	var err error
+	*d, err = ParseDuration(s)
+	return err
+}
+
+func (d Duration) String() string { return time.Duration(d).String() }
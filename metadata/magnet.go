@@ -0,0 +1,123 @@
+package metadata
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const magnetPrefix = "magnet:?"
+
+// ParseMagnet parses a magnet URI. The display name (dn), exact length (xl),
+// trackers (tr, one announce-list tier each), and BitTorrent info-hashes
+// (xt=urn:btih: and xt=urn:btmh:) are used to populate the returned Metadata.
+// Info.Pieces is always empty.
+func ParseMagnet(uri string) (*Metadata, error) {
+	if !strings.HasPrefix(uri, magnetPrefix) {
+		return nil, fmt.Errorf("not a magnet uri")
+	}
+	query, err := url.ParseQuery(uri[len(magnetPrefix):])
+	if err != nil {
+		return nil, fmt.Errorf("magnet: %v", err)
+	}
+	meta := &Metadata{Magnet: uri, Info: new(TorrentInfo)}
+	for _, xt := range query["xt"] {
+		switch {
+		case strings.HasPrefix(xt, "urn:btih:"):
+			meta.infoHash, err = parseBTIH(xt[len("urn:btih:"):])
+		case strings.HasPrefix(xt, "urn:btmh:"):
+			meta.infoHashV2, err = parseBTMH(xt[len("urn:btmh:"):])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("magnet: xt: %v", err)
+		}
+	}
+	if meta.infoHash == "" && meta.infoHashV2 == "" {
+		return nil, fmt.Errorf("magnet: no btih or btmh exact topic")
+	}
+	meta.Info.Name = query.Get("dn")
+	if meta.Info.Name == "" {
+		meta.Info.Name = meta.infoHash
+	}
+	if meta.Info.Name == "" {
+		meta.Info.Name = meta.infoHashV2
+	}
+	// Each tracker is given its own tier.
+	for _, tr := range query["tr"] {
+		if meta.Announce == "" {
+			meta.Announce = tr
+		}
+		meta.AnnounceList = append(meta.AnnounceList, []string{tr})
+	}
+	if xl := query.Get("xl"); xl != "" {
+		meta.Info.Length, err = strconv.ParseInt(xl, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("magnet: xl: %v", err)
+		}
+	}
+	return meta, nil
+}
+
+// Returns the lower-case hex encoding of a hex or base32 encoded btih.
+func parseBTIH(btih string) (string, error) {
+	switch len(btih) {
+	case 40:
+		p, err := hex.DecodeString(btih)
+		if err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(p), nil
+	case 32:
+		p, err := base32.StdEncoding.DecodeString(strings.ToUpper(btih))
+		if err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(p), nil
+	}
+	return "", fmt.Errorf("invalid btih length: %d", len(btih))
+}
+
+// Returns the lower-case hex encoding of the SHA-256 digest in a hex encoded
+// btmh multihash.
+func parseBTMH(btmh string) (string, error) {
+	const sha256Prefix = "1220" // multihash code and length for sha2-256
+	if len(btmh) != len(sha256Prefix)+64 || !strings.HasPrefix(btmh, sha256Prefix) {
+		return "", fmt.Errorf("invalid btmh: %s", btmh)
+	}
+	p, err := hex.DecodeString(btmh[len(sha256Prefix):])
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(p), nil
+}
+
+// Parses the first magnet URI found at the beginning of a line in p.
+func readMagnet(p []byte) (*Metadata, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(p))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, magnetPrefix) {
+			return ParseMagnet(line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("no magnet uri")
+}
+
+// Read the first magnet URI in a file (e.g. a .magnet file saved by a web
+// browser).
+func ReadMagnetFile(path string) (*Metadata, error) {
+	p, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return readMagnet(p)
+}
@@ -11,9 +11,15 @@ package metadata
  */
 
 import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"github.com/bmatsuo/gorrent/bencode"
 	"io/ioutil"
+	"sort"
+	"strings"
 )
 
 // One file in a multi-file Metadata object.
@@ -27,23 +33,94 @@ type FileInfo struct {
 type TorrentInfo struct {
 	Name        string      // Name of file (single-file mode) or directory (multi-file mode)
 	Files       []*FileInfo // Nil if and only if single-file mode
+	Length      int64       // Length in bytes (single-file mode).
 	MD5Sum      string      // Optional -- Non-empty if and only if single-file mode.
-	Pieces      string      // SHA-1 hash values of all pieces
+	Pieces      string      // SHA-1 hash values of all pieces (empty for pure v2 torrents)
 	PieceLength int64       // Length in bytes.
 	Private     bool        // Optional
+	MetaVersion int64       // 1, or 2 for v2 and hybrid torrents (BEP-52). Zero for magnet links.
 }
 
 // Returns true if info is in Single file mode.
 func (info *TorrentInfo) SingleFileMode() bool { return info.Files == nil }
 
+// Returns the number of files in the torrent.
+func (info *TorrentInfo) NumFiles() int {
+	if info.SingleFileMode() {
+		return 1
+	}
+	return len(info.Files)
+}
+
+// Returns the combined length of all files in the torrent.
+func (info *TorrentInfo) TotalLength() int64 {
+	if info.SingleFileMode() {
+		return info.Length
+	}
+	var total int64
+	for _, file := range info.Files {
+		total += file.Length
+	}
+	return total
+}
+
+// Returns the length of the largest file in the torrent.
+func (info *TorrentInfo) MaxFileLength() int64 {
+	if info.SingleFileMode() {
+		return info.Length
+	}
+	var max int64
+	for _, file := range info.Files {
+		if file.Length > max {
+			max = file.Length
+		}
+	}
+	return max
+}
+
 // The contents of a .torrent file.
 type Metadata struct {
 	Info         *TorrentInfo // Required
-	Announce     string       // Required
+	Announce     string       // Required, unless AnnounceList is non-empty.
+	AnnounceList [][]string   // Optional -- Tiers of tracker urls (BEP-12).
 	CreationDate int64        // Optional
 	Encoding     string       // Optional
 	CreatedBy    string       // Optional
 	Comment      string       // Optional
+	Magnet       string       // The magnet URI (magnet links only).
+
+	infoHash   string // Hex-encoded, if known.
+	infoHashV2 string // Hex-encoded, if known.
+}
+
+// Returns the hex-encoded (v1) info-hash of the torrent, or an empty string if
+// it is not known. The v1 info-hash is the SHA-1 hash of the bencoded info
+// dictionary.
+func (meta *Metadata) InfoHash() string { return meta.infoHash }
+
+// Returns the hex-encoded v2 (BEP-52) info-hash of the torrent, or an empty
+// string if the torrent is not a v2 or hybrid torrent. The v2 info-hash is the
+// SHA-256 hash of the bencoded info dictionary.
+func (meta *Metadata) InfoHashV2() string { return meta.infoHashV2 }
+
+// Returns the primary tracker url followed by the distinct urls of all
+// announce-list tiers.
+func (meta *Metadata) Trackers() []string {
+	var urls []string
+	seen := make(map[string]bool)
+	add := func(url string) {
+		if url != "" && !seen[url] {
+			seen[url] = true
+			urls = append(urls, url)
+		}
+	}
+	add(meta.Announce)
+	for _, tier := range meta.AnnounceList {
+		for _, url := range tier {
+			add(url)
+		}
+	}
+	return urls
 }
 
 func tryCastKey(m map[string]interface{}, key string, action func(interface{}), required bool) {
@@ -61,11 +138,28 @@ func tryCast(name string, v interface{}, action func(interface{}), required bool
 	action(v)
 }
 
+// Read a .torrent file or a file containing a magnet URI.
+func ReadFile(path string) (*Metadata, error) {
+	p, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Contains(p, []byte(magnetPrefix)) && !bytes.HasPrefix(p, []byte("d")) {
+		return readMagnet(p)
+	}
+	return ReadMetadata(p)
+}
+
 func ReadMetadataFile(torrent string) (meta *Metadata, err error) {
 	p, err := ioutil.ReadFile(torrent)
 	if err != nil {
 		return nil, err
 	}
+	return ReadMetadata(p)
+}
+
+// Read bencoded .torrent file contents.
+func ReadMetadata(p []byte) (meta *Metadata, err error) {
 	data, err := bencode.NewDecoder(p).DecodeAll()
 	switch {
 	case err != nil:
@@ -83,7 +177,22 @@ func ReadMetadataFile(torrent string) (meta *Metadata, err error) {
 	var _meta map[string]interface{}
 	tryCast("torrent", data[0], func(v interface{}) { _meta = v.(map[string]interface{}) }, true)
 	meta = new(Metadata)
-	tryCastKey(_meta, "announce", func(v interface{}) { meta.Announce = v.(string) }, true)
+	var _tiers []interface{}
+	tryCastKey(_meta, "announce-list", func(v interface{}) { _tiers = v.([]interface{}) }, false)
+	for i, _tierI := range _tiers {
+		var _tier []interface{}
+		tryCast(fmt.Sprintf("announce-list tier %d", i), _tierI,
+			func(v interface{}) { _tier = v.([]interface{}) }, true)
+		var tier []string
+		for j, url := range _tier {
+			tryCast(fmt.Sprintf("announce-list tier %d: url %d", i, j), url,
+				func(v interface{}) { tier = append(tier, v.(string)) }, true)
+		}
+		if len(tier) > 0 {
+			meta.AnnounceList = append(meta.AnnounceList, tier)
+		}
+	}
+	tryCastKey(_meta, "announce", func(v interface{}) { meta.Announce = v.(string) }, len(meta.AnnounceList) == 0)
 	tryCastKey(_meta, "encoding", func(v interface{}) { meta.Encoding = v.(string) }, false)
 	tryCastKey(_meta, "comment", func(v interface{}) { meta.Comment = v.(string) }, false)
 	tryCastKey(_meta, "created by", func(v interface{}) { meta.CreatedBy = v.(string) }, false)
@@ -92,9 +201,25 @@ func ReadMetadataFile(torrent string) (meta *Metadata, err error) {
 	tryCastKey(_meta, "info", func(v interface{}) { _info = v.(map[string]interface{}) }, true)
 	info := new(TorrentInfo)
 	meta.Info = info
+	info.MetaVersion = 1
+	tryCastKey(_info, "meta version", func(v interface{}) { info.MetaVersion = v.(int64) }, false)
+	rawInfo, err := rawDictValue(p, "info")
+	if err != nil {
+		return nil, err
+	}
+	_, hasPieces := _info["pieces"]
+	if hasPieces || info.MetaVersion < 2 {
+		sum := sha1.Sum(rawInfo)
+		meta.infoHash = hex.EncodeToString(sum[:])
+	}
+	if info.MetaVersion >= 2 {
+		sum := sha256.Sum256(rawInfo)
+		meta.infoHashV2 = hex.EncodeToString(sum[:])
+	}
 	tryCastKey(_info, "name", func(v interface{}) { info.Name = v.(string) }, true)
-	tryCastKey(_info, "pieces", func(v interface{}) { info.Pieces = v.(string) }, true)
+	tryCastKey(_info, "pieces", func(v interface{}) { info.Pieces = v.(string) }, info.MetaVersion < 2)
 	tryCastKey(_info, "md5sum", func(v interface{}) { info.MD5Sum = v.(string) }, false)
+	tryCastKey(_info, "length", func(v interface{}) { info.Length = v.(int64) }, false)
 	tryCastKey(_info, "private", func(v interface{}) { info.Private = v.(int64) == 1 }, false)
 	tryCastKey(_info, "piece length", func(v interface{}) { info.PieceLength = v.(int64) }, true)
 	var _fileIs []interface{}
@@ -114,5 +239,44 @@ func ReadMetadataFile(torrent string) (meta *Metadata, err error) {
 		}
 		info.Files = append(info.Files, file)
 	}
+	// Pure v2 torrents describe their files only in the file tree. Hybrid
+	// torrents use the v1 file list.
+	if _, hasLength := _info["length"]; info.MetaVersion >= 2 && _fileIs == nil && !hasLength {
+		var tree map[string]interface{}
+		tryCastKey(_info, "file tree", func(v interface{}) { tree = v.(map[string]interface{}) }, true)
+		files := readFileTree(nil, tree)
+		if len(files) == 1 && len(files[0].Path) == 1 && files[0].Path[0] == info.Name {
+			info.Length = files[0].Length
+		} else {
+			info.Files = files
+		}
+	}
 	return meta, nil
 }
+
+// Flattens a v2 (BEP-52) file tree into a list of files in lexical order.
+// Leaf nodes are dictionaries with an empty key, mapped to file attributes.
+func readFileTree(dir []string, tree map[string]interface{}) []*FileInfo {
+	names := make([]string, 0, len(tree))
+	for name := range tree {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var files []*FileInfo
+	for _, name := range names {
+		path := append(append([]string(nil), dir...), name)
+		var node map[string]interface{}
+		tryCast(fmt.Sprintf("file tree %q", strings.Join(path, "/")), tree[name],
+			func(v interface{}) { node = v.(map[string]interface{}) }, true)
+		if _, ok := node[""]; !ok {
+			files = append(files, readFileTree(path, node)...)
+			continue
+		}
+		var attrs map[string]interface{}
+		tryCastKey(node, "", func(v interface{}) { attrs = v.(map[string]interface{}) }, true)
+		file := &FileInfo{Path: path}
+		tryCastKey(attrs, "length", func(v interface{}) { file.Length = v.(int64) }, true)
+		files = append(files, file)
+	}
+	return files
+}
@@ -7,11 +7,167 @@ package metadata
  */
 
 import (
+    "crypto/sha1"
+    "encoding/hex"
+    "strings"
     "testing"
 )
 
 
 func TestMetadata(t *testing.T) {
+	meta, err := ReadMetadata([]byte("d" +
+		"8:announce17:http://a/announce" +
+		"13:announce-listll17:http://a/announceel17:http://b/announce17:http://a/announceee" +
+		"4:infod6:lengthi5e4:name3:foo12:piece lengthi16384e6:pieces0:e" +
+		"e"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha1.Sum([]byte("d6:lengthi5e4:name3:foo12:piece lengthi16384e6:pieces0:e"))
+	if hash := hex.EncodeToString(sum[:]); meta.InfoHash() != hash {
+		t.Errorf("info-hash %q (expected %q)", meta.InfoHash(), hash)
+	}
+	if meta.InfoHashV2() != "" {
+		t.Errorf("unexpected v2 info-hash: %q", meta.InfoHashV2())
+	}
+	if meta.Info.Name != "foo" || meta.Info.Length != 5 {
+		t.Errorf("unexpected info: %#v", meta.Info)
+	}
+	if len(meta.AnnounceList) != 2 {
+		t.Errorf("unexpected announce-list: %q", meta.AnnounceList)
+	}
+	trackers := meta.Trackers()
+	if len(trackers) != 2 || trackers[0] != "http://a/announce" || trackers[1] != "http://b/announce" {
+		t.Errorf("unexpected trackers: %q", trackers)
+	}
 
+	if _, err := ReadMetadata([]byte("d4:infod4:name3:foo12:piece lengthi1e6:pieces0:ee")); err == nil {
+		t.Errorf("expected error for missing announce")
+	}
 }
 
+
+var magnetTests = []struct {
+	uri      string
+	name     string
+	announce string
+	length   int64
+	hash     string
+}{
+	{
+		"magnet:?xt=urn:btih:C12FE1C06BBA254A9DC9F519B335AA7C1367A88A&dn=ubuntu-14.04-desktop-amd64.iso&xl=1010827264&tr=http%3A%2F%2Ftorrent.ubuntu.com%3A6969%2Fannounce",
+		"ubuntu-14.04-desktop-amd64.iso",
+		"http://torrent.ubuntu.com:6969/announce",
+		1010827264,
+		"c12fe1c06bba254a9dc9f519b335aa7c1367a88a",
+	},
+	{
+		"magnet:?xt=urn:btih:yex6dqdlxisuvhoj6um3gnnkpqjwpkek",
+		"c12fe1c06bba254a9dc9f519b335aa7c1367a88a",
+		"",
+		0,
+		"c12fe1c06bba254a9dc9f519b335aa7c1367a88a",
+	},
+}
+
+func TestParseMagnet(t *testing.T) {
+	for i, test := range magnetTests {
+		meta, err := ParseMagnet(test.uri)
+		if err != nil {
+			t.Errorf("Test %d: parse error: %v", i, err)
+			continue
+		}
+		if meta.Info.Name != test.name {
+			t.Errorf("Test %d: name %q (expected %q)", i, meta.Info.Name, test.name)
+		}
+		if meta.Announce != test.announce {
+			t.Errorf("Test %d: announce %q (expected %q)", i, meta.Announce, test.announce)
+		}
+		if meta.Info.Length != test.length {
+			t.Errorf("Test %d: length %d (expected %d)", i, meta.Info.Length, test.length)
+		}
+		if meta.InfoHash() != test.hash {
+			t.Errorf("Test %d: hash %q (expected %q)", i, meta.InfoHash(), test.hash)
+		}
+	}
+	meta, err := ParseMagnet("magnet:?xt=urn:btmh:1220caf1e1c30e81cb361b9ee167c4aa64228a7fa4fa9f6105232b28ad099f3a302e&dn=bittorrent-v2-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.InfoHashV2() != "caf1e1c30e81cb361b9ee167c4aa64228a7fa4fa9f6105232b28ad099f3a302e" || meta.InfoHash() != "" {
+		t.Errorf("unexpected info-hashes: %q %q", meta.InfoHash(), meta.InfoHashV2())
+	}
+	for _, uri := range []string{"http://example.com", "magnet:?dn=foo", "magnet:?xt=urn:btih:123", "magnet:?xt=urn:btmh:1114abcd"} {
+		if _, err := ParseMagnet(uri); err == nil {
+			t.Errorf("expected error parsing %q", uri)
+		}
+	}
+}
+
+func TestRawDictValue(t *testing.T) {
+	p := []byte("d1:ali1ei2ee4:infod1:xl1:ye1:zi3ee1:zd1:a0:ee")
+	for _, test := range []struct {
+		key string
+		raw string
+	}{
+		{"a", "li1ei2ee"},
+		{"info", "d1:xl1:ye1:zi3ee"},
+		{"z", "d1:a0:e"},
+		{"missing", ""},
+	} {
+		raw, err := rawDictValue(p, test.key)
+		if err != nil {
+			t.Errorf("%q: %v", test.key, err)
+		} else if string(raw) != test.raw {
+			t.Errorf("%q: raw %q (expected %q)", test.key, raw, test.raw)
+		}
+	}
+	for _, p := range []string{"", "le", "d1:a", "d1:ai1e"} {
+		if _, err := rawDictValue([]byte(p), "info"); err == nil {
+			t.Errorf("%q: expected error", p)
+		}
+	}
+}
+
+func TestMetadataV2(t *testing.T) {
+	for i, test := range []struct {
+		info  string
+		files [][]string
+		size  int64
+	}{
+		{
+			"d9:file treed3:food0:d6:lengthi7eeee12:meta versioni2e4:name3:foo12:piece lengthi16384ee",
+			nil,
+			7,
+		},
+		{
+			"d9:file treed1:bd0:d6:lengthi4eee3:dird1:ad0:d6:lengthi3eeeee12:meta versioni2e4:name3:foo12:piece lengthi16384ee",
+			[][]string{{"b"}, {"dir", "a"}},
+			0,
+		},
+	} {
+		meta, err := ReadMetadata([]byte("d8:announce17:http://a/announce4:info" + test.info + "e"))
+		if err != nil {
+			t.Errorf("Test %d: %v", i, err)
+			continue
+		}
+		if meta.Info.MetaVersion != 2 {
+			t.Errorf("Test %d: meta version %d", i, meta.Info.MetaVersion)
+		}
+		if meta.InfoHash() != "" || meta.InfoHashV2() == "" {
+			t.Errorf("Test %d: unexpected info-hashes: %q %q", i, meta.InfoHash(), meta.InfoHashV2())
+		}
+		if meta.Info.Length != test.size {
+			t.Errorf("Test %d: length %d (expected %d)", i, meta.Info.Length, test.size)
+		}
+		if len(meta.Info.Files) != len(test.files) {
+			t.Errorf("Test %d: %d files (expected %d)", i, len(meta.Info.Files), len(test.files))
+			continue
+		}
+		for j, file := range meta.Info.Files {
+			if strings.Join(file.Path, "/") != strings.Join(test.files[j], "/") {
+				t.Errorf("Test %d: file %d path %q (expected %q)", i, j, file.Path, test.files[j])
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package metadata
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// rawDictValue returns the bencoded bytes of the value for key in the
+// bencoded dictionary p, or nil if p contains no such key.
+func rawDictValue(p []byte, key string) ([]byte, error) {
+	if len(p) == 0 || p[0] != 'd' {
+		return nil, fmt.Errorf("not a dictionary")
+	}
+	i := 1
+	for i < len(p) && p[i] != 'e' {
+		k, j, err := rawString(p, i)
+		if err != nil {
+			return nil, err
+		}
+		end, err := skipValue(p, j)
+		if err != nil {
+			return nil, err
+		}
+		if string(k) == key {
+			return p[j:end], nil
+		}
+		i = end
+	}
+	if i >= len(p) {
+		return nil, fmt.Errorf("unterminated dictionary")
+	}
+	return nil, nil
+}
+
+// rawString returns the contents of the bencoded string at p[i:] and the
+// offset following it.
+func rawString(p []byte, i int) ([]byte, int, error) {
+	colon := bytes.IndexByte(p[i:], ':')
+	if colon < 0 {
+		return nil, 0, fmt.Errorf("invalid string at offset %d", i)
+	}
+	n, err := strconv.Atoi(string(p[i : i+colon]))
+	if err != nil || n < 0 {
+		return nil, 0, fmt.Errorf("invalid string length at offset %d", i)
+	}
+	start := i + colon + 1
+	if start+n > len(p) {
+		return nil, 0, fmt.Errorf("string overflows data at offset %d", i)
+	}
+	return p[start : start+n], start + n, nil
+}
+
+// skipValue returns the offset following the bencoded value at p[i:].
+func skipValue(p []byte, i int) (int, error) {
+	if i >= len(p) {
+		return 0, fmt.Errorf("unexpected end of data")
+	}
+	switch c := p[i]; {
+	case c == 'i':
+		end := bytes.IndexByte(p[i:], 'e')
+		if end < 0 {
+			return 0, fmt.Errorf("unterminated integer at offset %d", i)
+		}
+		return i + end + 1, nil
+	case c == 'l' || c == 'd':
+		i++
+		for i < len(p) && p[i] != 'e' {
+			var err error
+			if i, err = skipValue(p, i); err != nil {
+				return 0, err
+			}
+		}
+		if i >= len(p) {
+			return 0, fmt.Errorf("unterminated %c", c)
+		}
+		return i + 1, nil
+	case '0' <= c && c <= '9':
+		_, end, err := rawString(p, i)
+		return end, err
+	}
+	return 0, fmt.Errorf("invalid bencoded data at offset %d", i)
+}
@@ -24,6 +24,8 @@ type Options struct {
 	Watch         []watcher.Config
 	LogPath       string
 	LogAccepts    string
+	DryRun        bool     // Explain how Files would be handled and exit.
+	Files         []string // Files to explain (dry-run only).
 }
 
 // attach command line flags to opt. call flag.Parse() after.
@@ -31,13 +33,14 @@ func setupFlags(opt *Options) {
 	flag.Int64Var((*int64)(&opt.PollFrequency), "poll", 0, "Specify a polling frequency (in seconds).")
 	flag.StringVar(&opt.watchStr, "watch", "", "Specify a set of directories to watch.")
 	flag.StringVar(&opt.ConfigPath, "config", "", "A config file to use instead of ~/.config/gutterd.json.")
+	flag.BoolVar(&opt.DryRun, "dry-run", false, "Explain which handler each file argument matches and exit.")
 }
 
 // check flags for acceptable values.
 func verifyFlags(opt *Options) error {
 	if opt.watchStr != "" {
 		for _, dir := range filepath.SplitList(opt.watchStr) {
-			opt.Watch = append(opt.Watch, watcher.Config(dir))
+			opt.Watch = append(opt.Watch, watcher.Dir(dir))
 		}
 		for _, w := range opt.Watch {
 			if err := w.Validate(); err != nil {
@@ -54,6 +57,14 @@ func parseFlags() *Options {
 	opt := new(Options)
 	setupFlags(opt)
 	flag.Parse()
+	// "gutterd test [options] file..." is equivalent to "gutterd -dry-run".
+	if flag.Arg(0) == "test" {
+		opt.DryRun = true
+		flag.CommandLine.Parse(flag.Args()[1:])
+	}
+	if opt.DryRun {
+		opt.Files = flag.Args()
+	}
 	verifyFlags(opt)
 	return opt
 }
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	"github.com/bmatsuo/gutterd/handler"
+	"github.com/bmatsuo/gutterd/statsd"
+	"github.com/bmatsuo/gutterd/watcher"
+)
+
+var configMut sync.RWMutex // Guards config and handlers.
+
+// Returns the current configuration and handlers.
+func currentConfig() (*Config, []*handler.Handler) {
+	configMut.RLock()
+	defer configMut.RUnlock()
+	return config, handlers
+}
+
+// Apply command line flag overrides to c.
+func applyOptions(c *Config) {
+	if opt.Watch != nil {
+		c.Watch = opt.Watch
+	}
+	if opt.PollFrequency > 0 {
+		c.PollFrequency = opt.PollFrequency
+	}
+}
+
+var reloadMut sync.Mutex // Serializes reloadConfig.
+
+// Reload the configuration file. If the new configuration is invalid, or its
+// watch directories cannot be registered, the current configuration is kept.
+// Otherwise handlers are replaced and watch directories are updated.
+func reloadConfig() error {
+	reloadMut.Lock()
+	defer reloadMut.Unlock()
+	defconfig := &Config{}
+	next, err := LoadConfig(opt.ConfigPath, defconfig)
+	if err != nil {
+		return err
+	}
+	if next == defconfig {
+		return fmt.Errorf("no configuration file: %s", opt.ConfigPath)
+	}
+	applyOptions(next)
+	nextHandlers := next.MakeHandlers()
+	nextStore, err := loadStore(next)
+	if err != nil {
+		return err
+	}
+
+	// Register new directories before committing, so that a failure leaves
+	// the current configuration in effect.
+	prev, _ := currentConfig()
+	setIntervals(next)
+	watched := watchDiff(next.Watch, prev.Watch)
+	polled := watchDiff(next.Poll, prev.Poll)
+	err = fs.Watch(watched...)
+	if err == nil {
+		err = fs.Poll(polled...)
+	}
+	if err != nil {
+		added := append(watched, polled...)
+		fs.Unwatch(added...)
+		restoreWatches(prev, added)
+		setIntervals(prev)
+		return err
+	}
+
+	configMut.Lock()
+	config, handlers = next, nextHandlers
+	configMut.Unlock()
+	setStore(nextStore)
+	if next.workers() != prev.workers() {
+		glog.Warningf("workers changed to %d; restart to apply", next.workers())
+	}
+	if next.Statsd != prev.Statsd {
+		glog.Warningf("statsd changed to %q; restart to apply", next.Statsd)
+	}
+
+	removed := append(watchDiff(prev.Watch, next.Watch), watchDiff(prev.Poll, next.Poll)...)
+	if err := fs.Unwatch(removed...); err != nil {
+		glog.Warningf("unable to stop watching removed directories; %v", err)
+	}
+	return nil
+}
+
+// Set the poll interval and quiet period of fs from c.
+func setIntervals(c *Config) {
+	fs.SetPollInterval(time.Duration(c.PollFrequency) * time.Second)
+	fs.SetQuietPeriod(c.quietPeriod())
+}
+
+// Register again the directories of c that share a path with dirs, after a
+// failed reload replaced or removed them.
+func restoreWatches(c *Config, dirs []watcher.Config) {
+	replaced := func(list []watcher.Config) []watcher.Config {
+		var found []watcher.Config
+		for _, x := range list {
+			for _, y := range dirs {
+				if filepath.Clean(x.Path) == filepath.Clean(y.Path) {
+					found = append(found, x)
+					break
+				}
+			}
+		}
+		return found
+	}
+	if err := fs.Watch(replaced(c.Watch)...); err != nil {
+		glog.Errorf("unable to restore watch directories; %v", err)
+	}
+	if err := fs.Poll(replaced(c.Poll)...); err != nil {
+		glog.Errorf("unable to restore poll directories; %v", err)
+	}
+}
+
+// Returns the directories in a that are not in b. Directories whose options
+// changed are in the difference.
+func watchDiff(a, b []watcher.Config) []watcher.Config {
+	var diff []watcher.Config
+	for _, x := range a {
+		found := false
+		for _, y := range b {
+			if reflect.DeepEqual(x, y) {
+				found = true
+			}
+		}
+		if !found {
+			diff = append(diff, x)
+		}
+	}
+	return diff
+}
+
+func reload() {
+	if err := reloadConfig(); err != nil {
+		statsd.Incr("config.reload.error", 1, 1)
+		glog.Errorf("configuration reload failed (%q); %v", opt.ConfigPath, err)
+		return
+	}
+	statsd.Incr("config.reload", 1, 1)
+	glog.Infof("configuration reloaded (%q)", opt.ConfigPath)
+}
+
+// Reload the configuration whenever the configuration file is written.
+func watchConfig(ctx context.Context, path string) error {
+	path = filepath.Clean(path)
+	w, err := watcher.NewInstrContext(ctx,
+		func(event *watcher.Event) bool {
+			return filepath.Clean(event.Name) == path && (event.IsCreate() || event.IsModify())
+		},
+		func(err error) {
+			glog.Warningf("config watcher error: %v", err)
+		})
+	if err != nil {
+		return err
+	}
+	// Watch the directory; editors often replace the file instead of writing it.
+	if err := w.Watch(watcher.Dir(filepath.Dir(path))); err != nil {
+		w.Close()
+		return err
+	}
+	go func() {
+		for _ = range w.Event {
+			reload()
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bmatsuo/gutterd/watcher"
+)
+
+func TestWatchDiff(t *testing.T) {
+	a, b := watcher.Dir("/a"), watcher.Dir("/b")
+	recursive := watcher.Config{Path: "/a", Recursive: true}
+	for i, test := range []struct {
+		a, b, diff []watcher.Config
+	}{
+		{nil, nil, nil},
+		{[]watcher.Config{a, b}, nil, []watcher.Config{a, b}},
+		{[]watcher.Config{a, b}, []watcher.Config{b}, []watcher.Config{a}},
+		{[]watcher.Config{a}, []watcher.Config{recursive}, []watcher.Config{a}},
+		{[]watcher.Config{a}, []watcher.Config{a, b}, nil},
+	} {
+		if diff := watchDiff(test.a, test.b); !reflect.DeepEqual(diff, test.diff) {
+			t.Errorf("Test %d: diff %v (expected %v)", i, diff, test.diff)
+		}
+	}
+}
+
+// Sets up the globals used by reloadConfig with the configuration file in a
+// temporary directory containing the directories in dirs. The returned
+// function restores the globals.
+func reloadTest(t *testing.T, dirs ...string) (dir string, restore func()) {
+	dir, err := ioutil.TempDir("", "gutterd-reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range dirs {
+		if err := os.Mkdir(filepath.Join(dir, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	prevOpt, prevConfig, prevHandlers, prevFs := opt, config, handlers, fs
+	opt = &Options{ConfigPath: filepath.Join(dir, "gutterd.json")}
+	fs, err = watcher.New(func(e *watcher.Event) bool { return e.IsCreate() })
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() {
+		fs.Close()
+		opt, config, handlers, fs = prevOpt, prevConfig, prevHandlers, prevFs
+		os.RemoveAll(dir)
+	}
+}
+
+// Writes a configuration watching dir and, if load is true, makes it the
+// current one.
+func writeConfig(t *testing.T, dir string, load bool) {
+	p := fmt.Sprintf(`{"watch": [%q], "pollFrequency": 60, "quietPeriod": -1, "handlers": [{"name": %q, "watch": %q}]}`,
+		dir, filepath.Base(dir), filepath.Join(filepath.Dir(dir), "out"))
+	if err := ioutil.WriteFile(opt.ConfigPath, []byte(p), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !load {
+		return
+	}
+	c, err := LoadConfig(opt.ConfigPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, handlers = c, c.MakeHandlers()
+	setIntervals(c)
+	if err := fs.Watch(c.Watch...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Returns the name of the directory of the next file reported by fs, or an
+// empty string if none is reported within a second.
+func nextEvent() string {
+	select {
+	case e := <-fs.Event:
+		return filepath.Base(filepath.Dir(e.Name))
+	case <-time.After(time.Second):
+		return ""
+	}
+}
+
+func touch(t *testing.T, path string) {
+	if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	dir, restore := reloadTest(t, "a", "b", "out")
+	defer restore()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	writeConfig(t, a, true)
+
+	writeConfig(t, b, false)
+	if err := reloadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if c, h := currentConfig(); len(c.Watch) != 1 || c.Watch[0].Path != b || h[0].Name != "b" {
+		t.Errorf("configuration not replaced: %v %v", c.Watch, h)
+	}
+	touch(t, filepath.Join(a, "x.torrent"))
+	touch(t, filepath.Join(b, "x.torrent"))
+	if name := nextEvent(); name != "b" {
+		t.Errorf("event from %q (expected b)", name)
+	}
+
+	// Invalid configurations are not applied.
+	writeConfig(t, filepath.Join(dir, "missing"), false)
+	if err := reloadConfig(); err == nil {
+		t.Errorf("invalid configuration applied")
+	}
+
+	// Neither are configurations whose directories cannot be watched.
+	fs.Close()
+	writeConfig(t, a, false)
+	if err := reloadConfig(); err == nil {
+		t.Errorf("configuration applied without watching its directories")
+	}
+	if c, _ := currentConfig(); c.Watch[0].Path != b {
+		t.Errorf("configuration replaced: %v", c.Watch)
+	}
+}
+
+func TestRestoreWatches(t *testing.T) {
+	dir, restore := reloadTest(t, "a", "out")
+	defer restore()
+	a := filepath.Join(dir, "a")
+	writeConfig(t, a, true)
+
+	// A failed reload replaced the options of a before it was rolled back.
+	replaced := []watcher.Config{{Path: a, Pattern: "*.magnet"}}
+	if err := fs.Watch(replaced...); err != nil {
+		t.Fatal(err)
+	}
+	fs.Unwatch(replaced...)
+	restoreWatches(config, replaced)
+	touch(t, filepath.Join(a, "x.torrent"))
+	if name := nextEvent(); name != "a" {
+		t.Errorf("watch not restored")
+	}
+}
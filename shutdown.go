@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+
+	"github.com/bmatsuo/gutterd/statsd"
+)
+
+// The default time allowed for handling queued files after a shutdown signal.
+const defaultShutdownTimeout = 30 * time.Second
+
+// The time allowed for workers to stop once queued files are abandoned.
+const abandonTimeout = time.Second
+
+// Handle signals. SIGHUP reloads the configuration, unless shutdown has been
+// called. SIGINT and SIGTERM call shutdown, and a second SIGINT or SIGTERM
+// exits immediately.
+func signalHandler(shutdown func()) {
+	sig := make(chan os.Signal, 2)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	stopping := false
+	for s := range sig {
+		switch {
+		case s == syscall.SIGHUP && stopping:
+			glog.Warningf("received %v during shutdown; not reloading", s)
+		case s == syscall.SIGHUP:
+			reload()
+		case stopping:
+			glog.Warningf("received %v during shutdown; exiting immediately", s)
+			exit(1)
+		default:
+			stopping = true
+			statsd.Incr("proc.shutdown", 1, 1)
+			glog.Infof("received %v; shutting down", s)
+			shutdown()
+		}
+	}
+}
+
+// Wait for the worker pool to handle the files already queued. If they are
+// not handled within the shutdown timeout, stopWork is called so that queued
+// files are abandoned and running commands are killed, and 1 is returned.
+// Otherwise 0 is returned.
+func drain(stopWork context.CancelFunc) int {
+	config, _ := currentConfig()
+	timeout := config.shutdownTimeout()
+	done := make(chan struct{})
+	go func() {
+		workers.close()
+		close(done)
+	}()
+	select {
+	case <-done:
+		glog.Info("shutdown complete")
+		return 0
+	case <-time.After(timeout):
+	}
+	// Give abandoned deliveries a moment to kill their commands.
+	stopWork()
+	select {
+	case <-done:
+	case <-time.After(abandonTimeout):
+	}
+	statsd.Incr("proc.shutdown.timeout", 1, 1)
+	glog.Errorf("shutdown timed out after %v; abandoning queued torrents", timeout)
+	return 1
+}
+
+// Exit with code after flushing stats and logs.
+func exit(code int) {
+	statsd.Incr("proc.exit", 1, 1)
+	if err := statsd.Close(); err != nil {
+		glog.Warningf("statsd close error; %v", err)
+	}
+	glog.Flush()
+	os.Exit(code)
+}
@@ -26,3 +26,12 @@ func stat(fn func() error) error {
 func Incr(name string, value int64, rate float32) error {
 	return stat(func() error { return client.Inc(name, value, rate) })
 }
+
+func Gauge(name string, value int64, rate float32) error {
+	return stat(func() error { return client.Gauge(name, value, rate) })
+}
+
+// Flush buffered stats and close the client.
+func Close() error {
+	return stat(func() error { return client.Close() })
+}
@@ -0,0 +1,89 @@
+// Package store persists records of routed torrents, keyed by info-hash.
+package store
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// A Record describes a torrent that has been routed to a handler.
+type Record struct {
+	Name    string    `json:"name"`           // Torrent name.
+	Path    string    `json:"path"`           // Original path of the .torrent file.
+	Handler string    `json:"handler"`        // Name of the matching handler.
+	Time    time.Time `json:"time"`           // Time of delivery.
+	Kept    bool      `json:"kept,omitempty"` // The .torrent file was left in place.
+}
+
+// A Store is a set of Records persisted as a JSON file. A Store is safe for
+// concurrent use.
+type Store struct {
+	path    string
+	mut     sync.Mutex
+	records map[string]*Record
+}
+
+// Open the store at path, creating its directory if necessary. A missing
+// file is treated as an empty store.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, records: make(map[string]*Record)}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	p, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(p, &s.records); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Returns the path of the store's file.
+func (s *Store) Path() string { return s.path }
+
+// Get the record for an info-hash.
+func (s *Store) Get(hash string) (*Record, bool) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	r, ok := s.records[hash]
+	return r, ok
+}
+
+// Put a record for an info-hash and write the store to disk.
+func (s *Store) Put(hash string, r *Record) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.records[hash] = r
+	return s.save()
+}
+
+// Write the store to a temporary file and rename it over s.path.
+func (s *Store) save() error {
+	p, err := json.MarshalIndent(s.records, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), ".store-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(p); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
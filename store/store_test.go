@@ -0,0 +1,42 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gutterd-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "gutterd", "torrents.json")
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Get("abc"); ok {
+		t.Errorf("unexpected record in empty store")
+	}
+	r := &Record{Name: "foo", Handler: "bar", Time: time.Unix(1400000000, 0).UTC()}
+	if err := s.Put("abc", r); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := s.Get("abc")
+	if !ok {
+		t.Fatalf("record not persisted")
+	}
+	if *got != *r {
+		t.Errorf("record %#v (expected %#v)", got, r)
+	}
+}
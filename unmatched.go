@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/golang/glog"
+
+	"github.com/bmatsuo/gutterd/handler"
+)
+
+// The suffix appended to unmatched files by the rename action.
+const unmatchedSuffix = ".unmatched"
+
+// Describes the handling of torrents that match no handler.
+type UnmatchedConfig struct {
+	Action string `json:"action"` // leave (default), move, delete or rename.
+	Dir    string `json:"dir"`    // Destination of unmatched files (move only).
+}
+
+func (uc *UnmatchedConfig) Validate() error {
+	switch uc.Action {
+	case "", "leave", "delete", "rename":
+	case "move":
+		if uc.Dir == "" {
+			return fmt.Errorf("unmatched: no dir for move action")
+		}
+		stat, err := os.Stat(uc.Dir)
+		if err != nil {
+			return fmt.Errorf("unmatched: %v", err)
+		}
+		if !stat.IsDir() {
+			return fmt.Errorf("unmatched: dir is not a directory: %s", uc.Dir)
+		}
+	default:
+		return fmt.Errorf("unmatched: unknown action %q", uc.Action)
+	}
+	return nil
+}
+
+// Apply the unmatched policy of the current configuration to the file at
+// path.
+func handleUnmatched(path string) {
+	config, _ := currentConfig()
+	if config.Unmatched == nil {
+		return
+	}
+	var err error
+	switch config.Unmatched.Action {
+	case "move":
+		_, err = handler.MoveInto(path, config.Unmatched.Dir)
+	case "delete":
+		err = os.Remove(path)
+	case "rename":
+		err = os.Rename(path, path+unmatchedSuffix)
+	default:
+		return
+	}
+	if err != nil {
+		glog.Errorf("unmatched %s failed (%q); %v", config.Unmatched.Action, path, err)
+		return
+	}
+	glog.Infof("unmatched %s file:%q", config.Unmatched.Action, path)
+}
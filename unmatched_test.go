@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestHandleUnmatched(t *testing.T) {
+	defer func(c *Config) { config = c }(config)
+	for i, test := range []struct {
+		unmatched *UnmatchedConfig
+		dl, dest  string // Files left in the download and destination directories.
+	}{
+		{nil, "download.torrent", ""},
+		{&UnmatchedConfig{Action: "leave"}, "download.torrent", ""},
+		{&UnmatchedConfig{Action: "delete"}, "", ""},
+		{&UnmatchedConfig{Action: "rename"}, "download.torrent.unmatched", ""},
+		{&UnmatchedConfig{Action: "move"}, "", "download (1).torrent download.torrent"},
+	} {
+		dir, err := ioutil.TempDir("", "gutterd-unmatched")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		dl, dest := filepath.Join(dir, "dl"), filepath.Join(dir, "dest")
+		for _, d := range []string{dl, dest} {
+			if err := os.Mkdir(d, 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if test.unmatched != nil && test.unmatched.Action == "move" {
+			test.unmatched.Dir = dest
+			// An earlier unmatched file with the same name is not replaced.
+			if err := ioutil.WriteFile(filepath.Join(dest, "download.torrent"), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		config = &Config{Unmatched: test.unmatched}
+
+		path := filepath.Join(dl, "download.torrent")
+		if err := ioutil.WriteFile(path, []byte(testTorrent), 0644); err != nil {
+			t.Fatal(err)
+		}
+		handleUnmatched(path)
+		if names := dirNames(t, dl); names != test.dl {
+			t.Errorf("Test %d: download directory %q (expected %q)", i, names, test.dl)
+		}
+		if names := dirNames(t, dest); names != test.dest {
+			t.Errorf("Test %d: destination directory %q (expected %q)", i, names, test.dest)
+		}
+	}
+}
+
+// Returns the sorted names of the files in dir, separated by spaces.
+func dirNames(t *testing.T, dir string) string {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	sort.Strings(names)
+	return strings.Join(names, " ")
+}
@@ -1,19 +1,184 @@
 package watcher
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
-type Config string
+// Backends used to detect new files.
+const (
+	Fsnotify = "fsnotify" // Filesystem notifications (the default).
+	Polling  = "poll"     // Periodic directory listings.
+)
+
+// A watched directory. In JSON a Config is either a path or an object.
+type Config struct {
+	Path      string   `json:"path"`      // The watched directory.
+	Recursive bool     `json:"recursive"` // Also watch subdirectories.
+	Depth     int      `json:"depth"`     // Maximum depth of watched subdirectories (0 is unlimited).
+	Exclude   []string `json:"exclude"`   // Globs matching subdirectories that are not watched.
+
+	Pattern      string   `json:"pattern"`      // Glob matching the names of reported files.
+	Ignore       []string `json:"ignore"`       // Globs matching files that are not reported.
+	Backend      string   `json:"backend"`      // fsnotify (default) or poll.
+	PollInterval int64    `json:"pollInterval"` // Poll interval in seconds (0 uses the Watcher's).
+	Handlers     []string `json:"handlers"`     // Names of handlers allowed to match (empty allows all).
+}
+
+// Returns a non-recursive Config for dir.
+func Dir(dir string) Config { return Config{Path: dir} }
+
+func (c *Config) UnmarshalJSON(p []byte) error {
+	if len(p) > 0 && p[0] == '"' {
+		*c = Config{}
+		return json.Unmarshal(p, &c.Path)
+	}
+	type config Config // no UnmarshalJSON method
+	dec := json.NewDecoder(bytes.NewReader(p))
+	dec.DisallowUnknownFields()
+	return dec.Decode((*config)(c))
+}
+
+func (c Config) String() string { return c.Path }
 
 func (c Config) Validate() error {
-	stat, err := os.Stat(string(c))
+	stat, err := os.Stat(c.Path)
 	if err != nil {
 		return err
 	}
 	if !stat.IsDir() {
-		return fmt.Errorf("watch is not a directory: %s", c)
+		return fmt.Errorf("watch is not a directory: %s", c.Path)
+	}
+	if c.Depth < 0 {
+		return fmt.Errorf("watch has negative depth: %s", c.Path)
+	}
+	for _, glob := range c.Exclude {
+		if _, err := filepath.Match(glob, ""); err != nil {
+			return fmt.Errorf("watch exclude %q: %v", glob, err)
+		}
+	}
+	for _, glob := range append([]string{c.Pattern}, c.Ignore...) {
+		if _, err := filepath.Match(glob, ""); err != nil {
+			return fmt.Errorf("watch pattern %q: %v", glob, err)
+		}
+	}
+	switch c.Backend {
+	case "", Fsnotify, Polling:
+	default:
+		return fmt.Errorf("watch has unknown backend %q: %s", c.Backend, c.Path)
+	}
+	if c.PollInterval < 0 {
+		return fmt.Errorf("watch has negative pollInterval: %s", c.Path)
 	}
 	return nil
 }
+
+// Returns true if handler is allowed to match files in c.
+func (c Config) Allows(handler string) bool {
+	if len(c.Handlers) == 0 {
+		return true
+	}
+	for _, name := range c.Handlers {
+		if name == handler {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the poll interval of c, or def if c does not have one.
+func (c Config) pollInterval(def func() time.Duration) func() time.Duration {
+	if c.PollInterval <= 0 {
+		return def
+	}
+	return func() time.Duration { return time.Duration(c.PollInterval) * time.Second }
+}
+
+// Returns true if the file at path, in a watched directory of c, is reported.
+func (c Config) accepts(path string) bool {
+	if c.Pattern != "" {
+		if ok, _ := filepath.Match(c.Pattern, filepath.Base(path)); !ok {
+			return false
+		}
+	}
+	return !matchAny(c.Ignore, c.Path, path)
+}
+
+// Returns true if dir is c.Path or, when c is recursive, a subdirectory of
+// c.Path that is watched.
+func (c Config) Contains(dir string) bool {
+	rel, err := filepath.Rel(c.Path, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	return rel == "." || c.includes(rel)
+}
+
+// Returns true if the subdirectory of c.Path at the relative path rel is
+// watched. The parent directories of rel are assumed to be watched.
+func (c Config) includes(rel string) bool {
+	if !c.Recursive {
+		return false
+	}
+	if c.Depth > 0 && strings.Count(rel, string(filepath.Separator))+1 > c.Depth {
+		return false
+	}
+	return !matchAny(c.Exclude, c.Path, filepath.Join(c.Path, rel))
+}
+
+// Returns true if a glob matches the name of path, or its slash-separated path
+// relative to root.
+func matchAny(globs []string, root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		rel = path
+	}
+	for _, glob := range globs {
+		base, _ := filepath.Match(glob, filepath.Base(path))
+		full, _ := filepath.Match(glob, filepath.ToSlash(rel))
+		if base || full {
+			return true
+		}
+	}
+	return false
+}
+
+// Calls dirFn for each watched directory under root, including root, and
+// fileFn for each file they contain that c accepts. root must be c.Path or a
+// watched subdirectory. Unreadable subdirectories are skipped.
+func (c Config) walk(root string, dirFn, fileFn func(path string)) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			return nil
+		}
+		if !info.IsDir() {
+			if fileFn != nil && c.accepts(path) {
+				fileFn(path)
+			}
+			return nil
+		}
+		if path != root && !c.Contains(path) {
+			return filepath.SkipDir
+		}
+		if dirFn != nil {
+			dirFn(path)
+		}
+		return nil
+	})
+}
+
+// Returns the paths of files in the watched directories of c that are
+// reported.
+func (c Config) Files() ([]string, error) {
+	var files []string
+	err := c.walk(c.Path, nil, func(path string) { files = append(files, path) })
+	return files, err
+}
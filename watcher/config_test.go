@@ -0,0 +1,92 @@
+package watcher
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestConfigJSON(t *testing.T) {
+	for i, test := range []struct {
+		json string
+		c    Config
+	}{
+		{`"/tmp/a"`, Config{Path: "/tmp/a"}},
+		{`{"path":"/tmp/a"}`, Config{Path: "/tmp/a"}},
+		{`{"path":"/tmp/a","recursive":true,"depth":2,"exclude":[".*"]}`,
+			Config{Path: "/tmp/a", Recursive: true, Depth: 2, Exclude: []string{".*"}}},
+		{`{"path":"/tmp/a","pattern":"*.torrent","ignore":["*.part"],"backend":"poll","pollInterval":5,"handlers":["foo"]}`,
+			Config{Path: "/tmp/a", Pattern: "*.torrent", Ignore: []string{"*.part"}, Backend: Polling, PollInterval: 5, Handlers: []string{"foo"}}},
+	} {
+		var c Config
+		if err := json.Unmarshal([]byte(test.json), &c); err != nil {
+			t.Errorf("Test %d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(c, test.c) {
+			t.Errorf("Test %d: expected %#v; got %#v", i, test.c, c)
+		}
+	}
+	for _, s := range []string{`{"path":"/tmp/a","recusive":true}`, `7`} {
+		var c Config
+		if err := json.Unmarshal([]byte(s), &c); err == nil {
+			t.Errorf("%s: expected error", s)
+		}
+	}
+}
+
+func TestConfigFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gutterd-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{
+		"a.torrent",
+		"a.txt",
+		"2012/b.torrent",
+		"2012/03/c.torrent",
+		".Trash/d.torrent",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, test := range []struct {
+		c     Config
+		files []string
+	}{
+		{Config{}, []string{"a.torrent", "a.txt"}},
+		{Config{Pattern: "*.torrent"}, []string{"a.torrent"}},
+		{Config{Ignore: []string{"*.txt"}}, []string{"a.torrent"}},
+		{Config{Recursive: true, Ignore: []string{"2012/*"}}, []string{".Trash/d.torrent", "2012/03/c.torrent", "a.torrent", "a.txt"}},
+		{Config{Recursive: true, Pattern: "*.torrent"}, []string{".Trash/d.torrent", "2012/03/c.torrent", "2012/b.torrent", "a.torrent"}},
+		{Config{Recursive: true, Pattern: "*.torrent", Depth: 1}, []string{".Trash/d.torrent", "2012/b.torrent", "a.torrent"}},
+		{Config{Recursive: true, Pattern: "*.torrent", Exclude: []string{".*"}}, []string{"2012/03/c.torrent", "2012/b.torrent", "a.torrent"}},
+		{Config{Recursive: true, Pattern: "*.torrent", Exclude: []string{"2012/*"}}, []string{".Trash/d.torrent", "2012/b.torrent", "a.torrent"}},
+	} {
+		test.c.Path = dir
+		paths, err := test.c.Files()
+		if err != nil {
+			t.Errorf("Test %d: %v", i, err)
+			continue
+		}
+		var files []string
+		for _, path := range paths {
+			rel, _ := filepath.Rel(dir, path)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		sort.Strings(files)
+		if !reflect.DeepEqual(files, test.files) {
+			t.Errorf("Test %d: expected %q; got %q", i, test.files, files)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package watcher
+
+import (
+	"os"
+	"time"
+)
+
+// A file that was created but has not yet been quiet for the quiet period.
+type pendingFile struct {
+	event *Event
+	size  int64
+	timer *time.Timer
+	gen   int // Incremented each time the timer is restarted.
+}
+
+// A timer firing for a pending file.
+type expiry struct {
+	name string
+	gen  int
+}
+
+// A debouncer delays create events until the created file has received no
+// modify events and its size has not changed for a quiet period. Browsers
+// create files before writing them, so files are often empty or partial when
+// the create event arrives. fsnotify reports files moved into a watched
+// directory as created, and does not report when a file is closed, so both
+// are subject to the quiet period.
+type debouncer struct {
+	quiet      func() time.Duration
+	errHandler func(error)
+	pending    map[string]*pendingFile
+	expired    chan expiry
+	done       chan struct{}
+}
+
+func newDebouncer(quiet func() time.Duration, errHandler func(error)) *debouncer {
+	return &debouncer{
+		quiet:      quiet,
+		errHandler: errHandler,
+		pending:    make(map[string]*pendingFile),
+		expired:    make(chan expiry),
+		done:       make(chan struct{}),
+	}
+}
+
+// run passes events from in to out, delaying create events until their files
+// are quiet. Pending files are dropped when in is closed.
+func (d *debouncer) run(in <-chan *Event, out func(*Event)) {
+	defer close(d.done)
+	for {
+		select {
+		case event, ok := <-in:
+			if !ok {
+				for _, p := range d.pending {
+					p.timer.Stop()
+				}
+				return
+			}
+			d.event(event, out)
+		case e := <-d.expired:
+			d.expire(e, out)
+		}
+	}
+}
+
+func (d *debouncer) event(event *Event, out func(*Event)) {
+	quiet := d.quiet()
+	p := d.pending[event.Name]
+	switch {
+	case quiet <= 0:
+		out(event)
+	case event.IsCreate():
+		if p == nil {
+			p = &pendingFile{event: event, size: -1}
+			if info, err := os.Stat(event.Name); err == nil {
+				p.size = info.Size()
+			}
+			d.pending[event.Name] = p
+		} else {
+			p.event.Op |= event.Op
+		}
+		d.schedule(p, quiet)
+	case p != nil && (event.IsDelete() || event.IsRename()):
+		p.timer.Stop()
+		delete(d.pending, event.Name)
+		out(event)
+	case p != nil && event.IsModify():
+		d.schedule(p, quiet)
+		out(event)
+	default:
+		out(event)
+	}
+}
+
+// schedule (re)starts the quiet period of p.
+func (d *debouncer) schedule(p *pendingFile, quiet time.Duration) {
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	p.gen++
+	e := expiry{p.event.Name, p.gen}
+	p.timer = time.AfterFunc(quiet, func() {
+		select {
+		case d.expired <- e:
+		case <-d.done:
+		}
+	})
+}
+
+// expire emits the create event of a pending file if its size did not change
+// during the quiet period. Otherwise the quiet period starts over.
+func (d *debouncer) expire(e expiry, out func(*Event)) {
+	p := d.pending[e.name]
+	if p == nil || p.gen != e.gen {
+		return // stale timer
+	}
+	info, err := os.Stat(e.name)
+	if err != nil {
+		delete(d.pending, e.name)
+		if !os.IsNotExist(err) {
+			d.errHandler(err)
+		}
+		return
+	}
+	if info.Size() != p.size {
+		p.size = info.Size()
+		d.schedule(p, d.quiet())
+		return
+	}
+	delete(d.pending, e.name)
+	out(p.event)
+}
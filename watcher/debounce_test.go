@@ -0,0 +1,82 @@
+package watcher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDebouncer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gutterd-debounce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const quiet = 50 * time.Millisecond
+	in := make(chan *Event)
+	out := make(chan *Event, 10)
+	d := newDebouncer(func() time.Duration { return quiet }, func(err error) { t.Error(err) })
+	go d.run(in, func(e *Event) { out <- e })
+	defer close(in)
+
+	expectNone := func(wait time.Duration) {
+		select {
+		case e := <-out:
+			t.Fatalf("unexpected event: %v", e)
+		case <-time.After(wait):
+		}
+	}
+	expect := func(name string, op Op) {
+		select {
+		case e := <-out:
+			if e.Name != name || e.Op != op {
+				t.Fatalf("unexpected event: %v", e)
+			}
+		case <-time.After(10 * quiet):
+			t.Fatalf("no event for %s", name)
+		}
+	}
+
+	// Create events are delayed while the file is being written.
+	partial := filepath.Join(dir, "partial.torrent")
+	if err := ioutil.WriteFile(partial, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	in <- &Event{Name: partial, Op: Create}
+	expectNone(quiet / 2)
+	if err := ioutil.WriteFile(partial, []byte("d4:infod"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	in <- &Event{Name: partial, Op: Modify}
+	expect(partial, Modify)
+	expectNone(quiet / 2)
+	expect(partial, Create)
+
+	// Files removed during the quiet period are never reported as created.
+	removed := filepath.Join(dir, "removed.torrent")
+	if err := ioutil.WriteFile(removed, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	in <- &Event{Name: removed, Op: Create}
+	if err := os.Remove(removed); err != nil {
+		t.Fatal(err)
+	}
+	in <- &Event{Name: removed, Op: Delete}
+	expect(removed, Delete)
+	expectNone(2 * quiet)
+
+	// Files whose size changes without modify events (e.g. when polled) are
+	// delayed until the size is stable.
+	polled := filepath.Join(dir, "polled.torrent")
+	if err := ioutil.WriteFile(polled, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	in <- &Event{Name: polled, Op: Create}
+	if err := ioutil.WriteFile(polled, []byte("d4:infod"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expect(polled, Create)
+}
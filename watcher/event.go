@@ -0,0 +1,57 @@
+package watcher
+
+import (
+	"gopkg.in/fsnotify.v0"
+)
+
+// The kinds of filesystem changes reported by a Watcher.
+type Op uint32
+
+const (
+	Create Op = 1 << iota
+	Modify
+	Delete
+	Rename
+)
+
+// An Event describes a change to a file in a watched directory. Events may
+// originate from fsnotify or from polling.
+type Event struct {
+	Name string // Path of the changed file.
+	Op   Op     // Bitmask of changes.
+}
+
+func (e *Event) IsCreate() bool { return e.Op&Create != 0 }
+func (e *Event) IsModify() bool { return e.Op&Modify != 0 }
+func (e *Event) IsDelete() bool { return e.Op&Delete != 0 }
+func (e *Event) IsRename() bool { return e.Op&Rename != 0 }
+
+func (e *Event) String() string {
+	var ops []byte
+	for _, op := range []struct {
+		op Op
+		c  byte
+	}{{Create, 'C'}, {Modify, 'M'}, {Delete, 'D'}, {Rename, 'R'}} {
+		if e.Op&op.op != 0 {
+			ops = append(ops, op.c)
+		}
+	}
+	return string(ops) + " " + e.Name
+}
+
+func fileEvent(event *fsnotify.FileEvent) *Event {
+	e := &Event{Name: event.Name}
+	if event.IsCreate() {
+		e.Op |= Create
+	}
+	if event.IsModify() || event.IsAttrib() {
+		e.Op |= Modify
+	}
+	if event.IsDelete() {
+		e.Op |= Delete
+	}
+	if event.IsRename() {
+		e.Op |= Rename
+	}
+	return e
+}
@@ -0,0 +1,78 @@
+package watcher
+
+import (
+	"time"
+)
+
+// A poller periodically lists a directory and reports new files. The
+// subdirectories of recursive directories are listed as well.
+type poller struct {
+	dir  Config
+	seen map[string]bool
+	done chan struct{}
+}
+
+// newPoller takes an initial listing of dir. Files present in the initial
+// listing are not reported.
+func newPoller(dir Config) (*poller, error) {
+	p := &poller{dir: dir, done: make(chan struct{})}
+	seen, err := p.list()
+	if err != nil {
+		return nil, err
+	}
+	p.seen = seen
+	return p, nil
+}
+
+func (p *poller) list() (map[string]bool, error) {
+	files, err := p.dir.Files()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool, len(files))
+	for _, path := range files {
+		names[path] = true
+	}
+	return names, nil
+}
+
+// scan lists p.dir and returns create events for any files not present in
+// the previous listing.
+func (p *poller) scan() ([]*Event, error) {
+	names, err := p.list()
+	if err != nil {
+		return nil, err
+	}
+	var events []*Event
+	for name := range names {
+		if !p.seen[name] {
+			events = append(events, &Event{Name: name, Op: Create})
+		}
+	}
+	p.seen = names
+	return events, nil
+}
+
+func (p *poller) run(interval func() time.Duration, events chan<- *Event, errHandler func(error)) {
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-time.After(interval()):
+		}
+		created, err := p.scan()
+		if err != nil {
+			errHandler(err)
+			continue
+		}
+		for _, event := range created {
+			select {
+			case events <- event:
+			case <-p.done:
+				return
+			}
+		}
+	}
+}
+
+func (p *poller) stop() { close(p.done) }
@@ -0,0 +1,55 @@
+package watcher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPollerScan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gutterd-poll")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	touch := func(name string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	touch("existing.torrent")
+
+	p, err := newPoller(Dir(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := p.scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 {
+		t.Errorf("unexpected events for existing files: %v", events)
+	}
+
+	touch("new.torrent")
+	events, err = p.scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event; got %v", events)
+	}
+	if !events[0].IsCreate() || events[0].Name != filepath.Join(dir, "new.torrent") {
+		t.Errorf("unexpected event: %v", events[0])
+	}
+
+	events, err = p.scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 {
+		t.Errorf("unexpected events on rescan: %v", events)
+	}
+}
@@ -1,12 +1,39 @@
 package watcher
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
 	"gopkg.in/fsnotify.v0"
 )
 
+// The default interval between scans of polled directories.
+const DefaultPollInterval = time.Minute
+
+// The default time a created file must go unmodified before it is reported.
+const DefaultQuietPeriod = 2 * time.Second
+
 type Watcher struct {
-	Event chan *fsnotify.FileEvent
+	Event chan *Event
 	*fsnotify.Watcher
+
+	raw          chan *Event
+	errHandler   func(error)
+	mut          sync.Mutex
+	pollInterval time.Duration
+	quietPeriod  time.Duration
+	watched      map[string]Config  // Watched directories by path.
+	subdirs      map[string]string  // Root paths of watched subdirectories.
+	pollers      map[string]*poller // Pollers by path.
+	wg           sync.WaitGroup
+	done         chan struct{} // Closed by Close.
+	closed       bool
 }
 
 func New(filter Filter) (*Watcher, error) {
@@ -15,40 +42,330 @@ func New(filter Filter) (*Watcher, error) {
 
 // instrumentable
 func NewInstr(filter Filter, errHandler func(error)) (*Watcher, error) {
+	return NewInstrContext(context.Background(), filter, errHandler)
+}
+
+// Like NewInstr, but the Watcher is closed when ctx is done.
+func NewInstrContext(ctx context.Context, filter Filter, errHandler func(error)) (*Watcher, error) {
 	w := &Watcher{
-		Event: make(chan *fsnotify.FileEvent, 1),
+		Event:        make(chan *Event, 1),
+		raw:          make(chan *Event, 1),
+		errHandler:   errHandler,
+		pollInterval: DefaultPollInterval,
+		quietPeriod:  DefaultQuietPeriod,
+		watched:      make(map[string]Config),
+		subdirs:      make(map[string]string),
+		pollers:      make(map[string]*poller),
+		done:         make(chan struct{}),
 	}
 	var err error
 	w.Watcher, err = fsnotify.NewWatcher()
 	if err != nil {
 		return nil, err
 	}
+	w.wg.Add(1)
 	go func() {
-		for event := range w.Watcher.Event {
+		defer w.wg.Done()
+		for {
+			select {
+			case event, ok := <-w.Watcher.Event:
+				if !ok {
+					return
+				}
+				w.forward(fileEvent(event))
+			case <-w.done:
+				return
+			}
+		}
+	}()
+	go func() {
+		newDebouncer(w.QuietPeriod, w.error).run(w.raw, func(event *Event) {
 			// TODO filter could take a long time...
 			if filter(event) {
 				w.Event <- event
 			}
-		}
+		})
 		close(w.Event)
 	}()
 	go func() {
 		for err := range w.Watcher.Error {
-			if errHandler != nil {
-				go errHandler(err)
-			}
+			w.error(err)
 		}
 	}()
+	if done := ctx.Done(); done != nil {
+		go func() {
+			<-done
+			w.Close()
+		}()
+	}
 	return w, nil
 }
 
+// Pass e, and create events for files found in new subdirectories, to the
+// debouncer. Events are dropped once the Watcher is closed.
+func (w *Watcher) forward(e *Event) {
+	created := w.track(e)
+	if c, ok := w.source(e.Name); !ok || c.accepts(e.Name) {
+		created = append([]*Event{e}, created...)
+	}
+	for _, e := range created {
+		select {
+		case w.raw <- e:
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *Watcher) error(err error) {
+	if w.errHandler != nil {
+		go w.errHandler(err)
+	}
+}
+
+// Returns the interval between scans of polled directories.
+func (w *Watcher) PollInterval() time.Duration {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	return w.pollInterval
+}
+
+// Set the interval between scans of polled directories. Non-positive values
+// restore DefaultPollInterval. The interval takes effect after the next scan.
+func (w *Watcher) SetPollInterval(interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	w.pollInterval = interval
+}
+
+// Returns the time a created file must go without modification, and without
+// changing size, before its create event is emitted.
+func (w *Watcher) QuietPeriod() time.Duration {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	return w.quietPeriod
+}
+
+// Set the quiet period of created files. Non-positive values disable the
+// quiet period; create events are emitted immediately.
+func (w *Watcher) SetQuietPeriod(quiet time.Duration) {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	w.quietPeriod = quiet
+}
+
+// Watch dirs for changes using fsnotify. Directories with the poll backend,
+// and directories fsnotify fails to register, are polled instead. The
+// subdirectories of recursive dirs are watched as well, including
+// subdirectories created later. Watching a directory again replaces its
+// options.
 func (w *Watcher) Watch(dirs ...Config) error {
+	if w.isClosed() {
+		return fmt.Errorf("watcher closed")
+	}
+	for _, d := range dirs {
+		d = cleaned(d)
+		if d.Backend == Polling {
+			if err := w.Poll(d); err != nil {
+				return err
+			}
+			continue
+		}
+		err := w.Watcher.Watch(d.Path)
+		if err == nil {
+			w.mut.Lock()
+			w.removeSubdirs(d.Path)
+			w.watched[d.Path] = d
+			w.mut.Unlock()
+			if d.Recursive {
+				w.watchTree(d, d.Path)
+			}
+			continue
+		}
+		if w.Poll(d) != nil {
+			return err
+		}
+		w.error(fmt.Errorf("%v; polling %s", err, d))
+	}
+	return nil
+}
+
+// Poll scans dirs every poll interval, or their own pollInterval, and emits
+// create events for files not present in the previous scan. Poll is useful for filesystems (NFS, SMB)
+// where fsnotify never fires. Polling a directory again replaces its options.
+func (w *Watcher) Poll(dirs ...Config) error {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	if w.closed {
+		return fmt.Errorf("watcher closed")
+	}
 	for _, d := range dirs {
-		if err := w.Watcher.Watch(string(d)); err != nil {
+		d = cleaned(d)
+		prev := w.pollers[d.Path]
+		if prev != nil && reflect.DeepEqual(prev.dir, d) {
+			continue
+		}
+		p, err := newPoller(d)
+		if err != nil {
 			return err
 		}
+		if prev != nil {
+			prev.stop()
+		}
+		w.pollers[d.Path] = p
+		interval := d.pollInterval(w.PollInterval)
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			p.run(interval, w.raw, w.error)
+		}()
+	}
+	return nil
+}
+
+// Unwatch stops watching or polling dirs. Directories registered since with
+// different options are not affected. Unwatch does nothing once the Watcher
+// is closed.
+func (w *Watcher) Unwatch(dirs ...Config) error {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	if w.closed {
+		return nil
+	}
+	for _, d := range dirs {
+		d = cleaned(d)
+		if p := w.pollers[d.Path]; p != nil && reflect.DeepEqual(p.dir, d) {
+			p.stop()
+			delete(w.pollers, d.Path)
+		}
+		if c, ok := w.watched[d.Path]; ok && reflect.DeepEqual(c, d) {
+			delete(w.watched, d.Path)
+			w.removeSubdirs(d.Path)
+			if err := w.Watcher.RemoveWatch(d.Path); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
 
-type Filter func(*fsnotify.FileEvent) bool
+// Stop watching the subdirectories of the recursive watch at root. The caller
+// must hold w.mut.
+func (w *Watcher) removeSubdirs(root string) {
+	for dir, r := range w.subdirs {
+		if r == root {
+			delete(w.subdirs, dir)
+			w.Watcher.RemoveWatch(dir)
+		}
+	}
+}
+
+// Returns d with a clean path. Watches are keyed by clean paths, as event
+// names are built from them.
+func cleaned(d Config) Config {
+	d.Path = filepath.Clean(d.Path)
+	return d
+}
+
+// Watch the subdirectories of dir included by c, and dir itself if it is not
+// c.Path. The paths of files found in the subdirectories are returned.
+func (w *Watcher) watchTree(c Config, dir string) []string {
+	var files []string
+	err := c.walk(dir,
+		func(path string) {
+			if path == c.Path {
+				return
+			}
+			if err := w.Watcher.Watch(path); err != nil {
+				w.error(err)
+				return
+			}
+			w.mut.Lock()
+			w.subdirs[path] = c.Path
+			w.mut.Unlock()
+		},
+		func(path string) { files = append(files, path) })
+	if err != nil {
+		w.error(err)
+	}
+	return files
+}
+
+// Update the watched subdirectories of recursive watches after event. Create
+// events are returned for files already present in new subdirectories, as
+// they may have been written before the subdirectory was watched.
+func (w *Watcher) track(event *Event) []*Event {
+	c, ok := w.source(event.Name)
+	if !ok || !c.Recursive {
+		return nil
+	}
+	if event.IsDelete() || event.IsRename() {
+		w.mut.Lock()
+		defer w.mut.Unlock()
+		prefix := event.Name + string(filepath.Separator)
+		for dir := range w.subdirs {
+			if dir == event.Name || strings.HasPrefix(dir, prefix) {
+				delete(w.subdirs, dir)
+				w.Watcher.RemoveWatch(dir) // deleted directories are removed automatically
+			}
+		}
+		return nil
+	}
+	if !event.IsCreate() || !c.Contains(event.Name) {
+		return nil
+	}
+	if info, err := os.Stat(event.Name); err != nil || !info.IsDir() {
+		return nil
+	}
+	var created []*Event
+	for _, path := range w.watchTree(c, event.Name) {
+		created = append(created, &Event{Name: path, Op: Create})
+	}
+	return created
+}
+
+// Returns the watched directory containing the file at path.
+func (w *Watcher) source(path string) (Config, bool) {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	root, ok := w.subdirs[filepath.Dir(path)]
+	if !ok {
+		root = filepath.Dir(path)
+	}
+	c, ok := w.watched[root]
+	return c, ok
+}
+
+func (w *Watcher) isClosed() bool {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	return w.closed
+}
+
+// Close stops all fsnotify watches and pollers. The Event channel is closed
+// once pending events have been delivered.
+func (w *Watcher) Close() error {
+	w.mut.Lock()
+	if w.closed {
+		w.mut.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.done)
+	for path, p := range w.pollers {
+		p.stop()
+		delete(w.pollers, path)
+	}
+	w.mut.Unlock()
+	err := w.Watcher.Close()
+	go func() {
+		w.wg.Wait()
+		close(w.raw)
+	}()
+	return err
+}
+
+type Filter func(*Event) bool
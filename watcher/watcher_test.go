@@ -0,0 +1,137 @@
+package watcher
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcherContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	w, err := NewInstrContext(ctx, func(*Event) bool { return true }, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	select {
+	case _, ok := <-w.Event:
+		if ok {
+			t.Errorf("unexpected event")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("watcher not closed")
+	}
+}
+
+func TestWatcherClosed(t *testing.T) {
+	path, err := ioutil.TempDir("", "gutterd-watcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+	w, err := New(func(*Event) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := Config{Path: path, Backend: Polling}
+	if err := w.Watch(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Unwatch(dir); err != nil {
+		t.Errorf("unwatch after close: %v", err)
+	}
+	if err := w.Watch(dir); err == nil {
+		t.Errorf("watch after close: no error")
+	}
+	select {
+	case _, ok := <-w.Event:
+		if ok {
+			t.Errorf("unexpected event")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("watcher not closed")
+	}
+}
+
+func TestWatcherUncleanPath(t *testing.T) {
+	path, err := ioutil.TempDir("", "gutterd-watcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+	w, err := New(func(e *Event) bool { return e.IsCreate() })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.SetQuietPeriod(0)
+	dir := Config{Path: path + "/", Recursive: true, Pattern: "*.torrent"}
+	if err := w.Watch(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(path, "a.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	sub := filepath.Join(path, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	torrent := filepath.Join(sub, "a.torrent")
+	if err := ioutil.WriteFile(torrent, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		select {
+		case e := <-w.Event:
+			if e.Name != torrent {
+				t.Fatalf("unexpected event: %s", e.Name)
+			}
+			return
+		case <-time.After(time.Second):
+			t.Fatalf("no event for %s", torrent)
+		}
+	}
+}
+
+func TestWatcherReplace(t *testing.T) {
+	path, err := ioutil.TempDir("", "gutterd-watcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+	w, err := New(func(*Event) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	prev := Config{Path: path}
+	next := Config{Path: path, Pattern: "*.torrent"}
+	polled := Config{Path: path, Backend: Polling}
+	for _, d := range []Config{prev, next, polled} {
+		if err := w.Watch(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Unwatch(prev); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := w.source(filepath.Join(path, "a.torrent")); !ok {
+		t.Errorf("replaced watch removed")
+	}
+	if err := w.Unwatch(next, polled); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := w.source(filepath.Join(path, "a.torrent")); ok {
+		t.Errorf("watch not removed")
+	}
+	if len(w.pollers) != 0 {
+		t.Errorf("poller not removed")
+	}
+}
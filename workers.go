@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/golang/glog"
+
+	"github.com/bmatsuo/gutterd/handler"
+	"github.com/bmatsuo/gutterd/statsd"
+)
+
+// The default number of files handled concurrently.
+const defaultWorkers = 4
+
+// The number of files that may wait for a worker before submit blocks.
+const queueSize = 1024
+
+// A file to handle and, optionally, a function called with the result.
+type job struct {
+	path string
+	done func(*handler.Handler, error)
+}
+
+// A pool handles files concurrently with a fixed number of workers. Files
+// already waiting or being handled are not submitted again.
+type pool struct {
+	ctx     context.Context // Passed to handleFile.
+	jobs    chan *job
+	mut     sync.Mutex
+	pending map[string]bool // Paths of waiting and in-progress jobs.
+	wg      sync.WaitGroup
+}
+
+// Start a pool of n workers. Files are not handled once ctx is done.
+func newPool(ctx context.Context, n int) *pool {
+	p := &pool{
+		ctx:     ctx,
+		jobs:    make(chan *job, queueSize),
+		pending: make(map[string]bool),
+	}
+	p.wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer p.wg.Done()
+			for j := range p.jobs {
+				p.handle(j)
+			}
+		}()
+	}
+	return p
+}
+
+func (p *pool) handle(j *job) {
+	statsd.Gauge("workers.queued", int64(len(p.jobs)), 1)
+	h, err := handleFile(p.ctx, j.path)
+	p.mut.Lock()
+	delete(p.pending, j.path)
+	p.mut.Unlock()
+	if j.done != nil {
+		j.done(h, err)
+	}
+}
+
+// Queue the file at path for handling. False is returned, and done is never
+// called, if the file is already queued or being handled.
+func (p *pool) submit(path string, done func(*handler.Handler, error)) bool {
+	p.mut.Lock()
+	if p.pending[path] {
+		p.mut.Unlock()
+		statsd.Incr("workers.skipped", 1, 1)
+		glog.Infof("already handling torrent (%q)", path)
+		return false
+	}
+	p.pending[path] = true
+	p.mut.Unlock()
+	p.jobs <- &job{path, done}
+	return true
+}
+
+// Stop accepting files and wait for queued and in-progress files to be
+// handled.
+func (p *pool) close() {
+	close(p.jobs)
+	p.wg.Wait()
+}
+
+// Locks the info-hashes of torrents being handled.
+var torrentLock keyLock
+
+// Serializes the handling of torrents with the same info-hash, so that
+// copies of a torrent are not delivered concurrently before either is
+// recorded in the store.
+type keyLock struct {
+	mut  sync.Mutex
+	busy map[string]chan struct{}
+}
+
+// Lock key, waiting until it is not locked by another goroutine.
+func (l *keyLock) lock(key string) {
+	for {
+		l.mut.Lock()
+		if l.busy == nil {
+			l.busy = make(map[string]chan struct{})
+		}
+		wait, busy := l.busy[key]
+		if !busy {
+			l.busy[key] = make(chan struct{})
+			l.mut.Unlock()
+			return
+		}
+		l.mut.Unlock()
+		<-wait
+	}
+}
+
+func (l *keyLock) unlock(key string) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	close(l.busy[key])
+	delete(l.busy, key)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bmatsuo/gutterd/handler"
+)
+
+func TestPool(t *testing.T) {
+	// Files are not handled by a pool without workers.
+	p := newPool(context.Background(), 0)
+	if !p.submit("a.torrent", nil) {
+		t.Errorf("first submission rejected")
+	}
+	if p.submit("a.torrent", nil) {
+		t.Errorf("pending path submitted again")
+	}
+	if !p.submit("b.torrent", nil) {
+		t.Errorf("other path rejected")
+	}
+
+	// Files are not handled once the pool's context is done, but done is
+	// still called for each.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p = newPool(ctx, 2)
+	results := make(chan error, 3)
+	done := func(h *handler.Handler, err error) { results <- err }
+	for _, path := range []string{"a.torrent", "b.torrent"} {
+		if !p.submit(path, done) {
+			t.Errorf("%s rejected", path)
+		}
+	}
+	if err := <-results; err != context.Canceled {
+		t.Errorf("unexpected error: %v", err)
+	}
+	p.close()
+	select {
+	case err := <-results:
+		if err != context.Canceled {
+			t.Errorf("unexpected error: %v", err)
+		}
+	default:
+		t.Errorf("close returned before queued files were handled")
+	}
+	if len(p.pending) != 0 {
+		t.Errorf("pending paths remain after close: %v", p.pending)
+	}
+}
+
+func TestKeyLock(t *testing.T) {
+	var l keyLock
+	l.lock("a")
+	locked := make(chan string, 2)
+	for _, key := range []string{"a", "b"} {
+		go func(key string) {
+			l.lock(key)
+			locked <- key
+			l.unlock(key)
+		}(key)
+	}
+	select {
+	case key := <-locked:
+		if key != "b" {
+			t.Fatalf("locked key %q acquired twice", key)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("unlocked key blocked")
+	}
+	select {
+	case <-locked:
+		t.Fatalf("locked key acquired twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+	l.unlock("a")
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatalf("unlocked key not acquired")
+	}
+}